@@ -0,0 +1,495 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache holds the module and build cache shared by the toolchain commands, guarded by a process and file lock.
+type Cache struct {
+	// Dir is the directory holding both caches.
+	Dir string
+
+	// MaxModSize and MaxBuildSize cap the size in bytes of the caches, zero means no cap.
+	MaxModSize   int64
+	MaxBuildSize int64
+
+	mu sync.RWMutex
+}
+
+// ErrCacheBusy is returned by TryPrune when the cache is in use.
+var ErrCacheBusy = errors.New("the cache is in use")
+
+// CacheStats describes the contents of a cache.
+type CacheStats struct {
+	ModSize      int64
+	ModEntries   int
+	BuildSize    int64
+	BuildEntries int
+}
+
+// PruneReport tells what a prune evicted.
+type PruneReport struct {
+	ModEvicted   int
+	ModFreed     int64
+	BuildEvicted int
+	BuildFreed   int64
+}
+
+// cacheEntry is something which can be evicted from a cache, together with the files belonging to it.
+type cacheEntry struct {
+	paths   []string
+	size    int64
+	modTime time.Time
+}
+
+// NewCache creates the cache directories below dir.
+func NewCache(dir string, maxModSize int64, maxBuildSize int64) (*Cache, error) {
+	c := &Cache{Dir: dir, MaxModSize: maxModSize, MaxBuildSize: maxBuildSize}
+
+	for _, d := range []string{c.ModDir(), c.BuildDir()} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create cache dir: %w", err)
+		}
+	}
+
+	return c, nil
+}
+
+// ModDir is the directory used as GOMODCACHE.
+func (c *Cache) ModDir() string {
+	return filepath.Join(c.Dir, "mod")
+}
+
+// BuildDir is the directory used as GOCACHE.
+func (c *Cache) BuildDir() string {
+	return filepath.Join(c.Dir, "build")
+}
+
+// Env returns the environment variables pointing the go toolchain to the cache.
+func (c *Cache) Env() []string {
+	return []string{
+		fmt.Sprintf("GOMODCACHE=%s", c.ModDir()),
+		fmt.Sprintf("GOCACHE=%s", c.BuildDir()),
+	}
+}
+
+// Use takes a shared lock on the cache, preventing it from being pruned until the returned function is called.
+func (c *Cache) Use() (func(), error) {
+	return c.lock(false, true)
+}
+
+// Stats walks the caches to find out how much they hold.
+func (c *Cache) Stats() (CacheStats, error) {
+	release, err := c.lock(false, true)
+	if err != nil {
+		return CacheStats{}, err
+	}
+	defer release()
+
+	var stats CacheStats
+	mods, err := c.modEntries()
+	if err != nil {
+		return stats, err
+	}
+	stats.ModEntries = len(mods)
+	stats.ModSize = totalSize(mods)
+
+	builds, err := c.buildEntries()
+	if err != nil {
+		return stats, err
+	}
+	stats.BuildEntries = len(builds)
+	stats.BuildSize = totalSize(builds)
+
+	return stats, nil
+}
+
+// Prune evicts the oldest entries from the caches exceeding their maximum size, waiting for builds to finish.
+func (c *Cache) Prune() (PruneReport, error) {
+	release, err := c.lock(true, true)
+	if err != nil {
+		return PruneReport{}, err
+	}
+	defer release()
+
+	return c.prune()
+}
+
+// TryPrune prunes like Prune, but returns ErrCacheBusy instead of waiting when the cache is in use.
+func (c *Cache) TryPrune() (PruneReport, error) {
+	release, err := c.lock(true, false)
+	if err != nil {
+		return PruneReport{}, err
+	}
+	defer release()
+
+	return c.prune()
+}
+
+func (c *Cache) prune() (PruneReport, error) {
+	var report PruneReport
+	if c.MaxModSize > 0 {
+		entries, err := c.modEntries()
+		if err != nil {
+			return report, err
+		}
+
+		report.ModEvicted, report.ModFreed, err = evict(entries, totalSize(entries), c.MaxModSize)
+		if err != nil {
+			return report, fmt.Errorf("failed to prune module cache: %w", err)
+		}
+	}
+
+	if c.MaxBuildSize > 0 {
+		entries, err := c.buildEntries()
+		if err != nil {
+			return report, err
+		}
+
+		report.BuildEvicted, report.BuildFreed, err = evict(entries, totalSize(entries), c.MaxBuildSize)
+		if err != nil {
+			return report, fmt.Errorf("failed to prune build cache: %w", err)
+		}
+	}
+
+	return report, nil
+}
+
+// Clear removes everything from the caches.
+func (c *Cache) Clear() error {
+	release, err := c.lock(true, true)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	for _, d := range []string{c.ModDir(), c.BuildDir()} {
+		if err := removeAll(d); err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lock takes the lock on the cache. Without wait, ErrCacheBusy is returned when the lock is held by someone else.
+func (c *Cache) lock(exclusive bool, wait bool) (func(), error) {
+	switch {
+	case !wait && exclusive:
+		if !c.mu.TryLock() {
+			return nil, ErrCacheBusy
+		}
+	case !wait:
+		if !c.mu.TryRLock() {
+			return nil, ErrCacheBusy
+		}
+	case exclusive:
+		c.mu.Lock()
+	default:
+		c.mu.RLock()
+	}
+
+	unlock := func() {
+		if exclusive {
+			c.mu.Unlock()
+		} else {
+			c.mu.RUnlock()
+		}
+	}
+
+	f, err := os.OpenFile(filepath.Join(c.Dir, ".lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		unlock()
+		return nil, fmt.Errorf("failed to open cache lock: %w", err)
+	}
+
+	if wait {
+		err = lockFile(f, exclusive)
+	} else {
+		var locked bool
+		if locked, err = tryLockFile(f, exclusive); err == nil && !locked {
+			err = ErrCacheBusy
+		}
+	}
+	if err != nil {
+		_ = f.Close()
+		unlock()
+		if errors.Is(err, ErrCacheBusy) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to lock cache: %w", err)
+	}
+
+	return func() {
+		_ = unlockFile(f)
+		_ = f.Close()
+		unlock()
+	}, nil
+}
+
+// modEntries returns the extracted and downloaded module versions and the vcs checkouts, aged by write time.
+func (c *Cache) modEntries() ([]cacheEntry, error) {
+	root := c.ModDir()
+	download := filepath.Join(root, "cache", "download")
+
+	var result []cacheEntry
+	claimed := map[string]bool{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() || p == root {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(root, p)
+		if rel == "cache" {
+			return filepath.SkipDir
+		}
+
+		module, version, ok := strings.Cut(rel, "@")
+		if !ok {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		entry := cacheEntry{paths: []string{p}, modTime: info.ModTime()}
+		downloads, _ := filepath.Glob(filepath.Join(download, module, "@v", version+".*"))
+		entry.paths = append(entry.paths, downloads...)
+		for _, ep := range entry.paths {
+			claimed[ep] = true
+			size, err := dirSize(ep)
+			if err != nil {
+				return err
+			}
+			entry.size += size
+		}
+
+		result = append(result, entry)
+		return filepath.SkipDir
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	downloads, err := downloadEntries(download, claimed)
+	if err != nil {
+		return nil, err
+	}
+	result = append(result, downloads...)
+
+	checkouts, err := vcsEntries(filepath.Join(root, "cache", "vcs"))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(result, checkouts...), nil
+}
+
+// downloadEntries groups the downloaded files of the module versions which were not extracted by version.
+func downloadEntries(root string, claimed map[string]bool) ([]cacheEntry, error) {
+	versions := map[string]*cacheEntry{}
+	var keys []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() || filepath.Base(filepath.Dir(p)) != "@v" || claimed[p] {
+			return nil
+		}
+
+		// -- the version lists are shared by all versions of a module
+		if strings.HasPrefix(d.Name(), "list") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		key := strings.TrimSuffix(p, filepath.Ext(p))
+		entry, fnd := versions[key]
+		if !fnd {
+			entry = &cacheEntry{}
+			versions[key] = entry
+			keys = append(keys, key)
+		}
+
+		entry.paths = append(entry.paths, p)
+		entry.size += info.Size()
+		if info.ModTime().After(entry.modTime) {
+			entry.modTime = info.ModTime()
+		}
+
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	result := make([]cacheEntry, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *versions[key])
+	}
+
+	return result, nil
+}
+
+// vcsEntries returns the repositories the go toolchain checked out to fetch modules directly from their origin.
+func vcsEntries(root string) ([]cacheEntry, error) {
+	dirs, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var result []cacheEntry
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		p := filepath.Join(root, d.Name())
+		entry := cacheEntry{paths: []string{p}, modTime: info.ModTime()}
+		companions, _ := filepath.Glob(p + ".*")
+		entry.paths = append(entry.paths, companions...)
+		for _, ep := range entry.paths {
+			size, err := dirSize(ep)
+			if err != nil {
+				return nil, err
+			}
+			entry.size += size
+		}
+
+		result = append(result, entry)
+	}
+
+	return result, nil
+}
+
+// buildEntries returns the files in the build cache, whose modification time the toolchain refreshes on use.
+func (c *Cache) buildEntries() ([]cacheEntry, error) {
+	root := c.BuildDir()
+
+	var result []cacheEntry
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// -- the files in the root of the cache describe the cache itself
+		if d.IsDir() || filepath.Dir(p) == root {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		result = append(result, cacheEntry{paths: []string{p}, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func totalSize(entries []cacheEntry) int64 {
+	var size int64
+	for _, e := range entries {
+		size += e.size
+	}
+
+	return size
+}
+
+// evict removes the oldest entries until the total size of the cache is within max.
+func evict(entries []cacheEntry, size int64, max int64) (int, int64, error) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+
+	var count int
+	var freed int64
+	for _, e := range entries {
+		if size-freed <= max {
+			break
+		}
+
+		for _, p := range e.paths {
+			if err := removeAll(p); err != nil {
+				return count, freed, err
+			}
+		}
+
+		count++
+		freed += e.size
+	}
+
+	return count, freed, nil
+}
+
+// removeAll removes the path, including the read-only directories the go toolchain extracts modules into.
+func removeAll(p string) error {
+	_ = filepath.WalkDir(p, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			_ = os.Chmod(p, 0755)
+		}
+		return nil
+	})
+
+	return os.RemoveAll(p)
+}
+
+func dirSize(p string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(p, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	return size, nil
+}
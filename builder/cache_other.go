@@ -0,0 +1,18 @@
+//go:build !unix
+
+package builder
+
+import "os"
+
+// lockFile is a no-op on platforms without flock, where the cache is only locked within the process.
+func lockFile(f *os.File, exclusive bool) error {
+	return nil
+}
+
+func tryLockFile(f *os.File, exclusive bool) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -1,24 +1,54 @@
 package builder
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 )
 
+// killGracePeriod is how long a cancelled toolchain command may take to exit before its process group is killed.
+const killGracePeriod = 5 * time.Second
+
 func InDir(dir string, goexec string) *InDirCommand {
 	return &InDirCommand{dir: dir, goexec: goexec}
 }
 
 type InDirCommand struct {
-	goexec string
-	dir    string
+	goexec  string
+	dir     string
+	output  io.Writer
+	limits  *Limits
+	env     []string
+	ldflags []string
+}
+
+// WithOutput sends the stdout and stderr of the toolchain commands to the given writer instead of os.Stdout.
+func (i *InDirCommand) WithOutput(w io.Writer) *InDirCommand {
+	i.output = w
+	return i
+}
+
+// WithEnv adds environment variables to the toolchain commands, on top of the environment of the current process.
+func (i *InDirCommand) WithEnv(env ...string) *InDirCommand {
+	i.env = append(i.env, env...)
+	return i
+}
+
+// WithLdflags passes the flags to the linker when building, like -X to set the value of a string variable.
+func (i *InDirCommand) WithLdflags(flags ...string) *InDirCommand {
+	i.ldflags = append(i.ldflags, flags...)
+	return i
 }
 
 func (i *InDirCommand) GoVersion(ctx context.Context) (string, error) {
 	cmd := exec.CommandContext(ctx, i.goexec, "version")
+	cmd.Dir = i.dir
+	cmd.Env = append(os.Environ(), i.env...)
 	out, err := cmd.Output()
 	if err != nil {
 		return "", err
@@ -28,33 +58,98 @@ func (i *InDirCommand) GoVersion(ctx context.Context) (string, error) {
 }
 
 func (i *InDirCommand) GoGet(ctx context.Context, url string) error {
-	cmd := exec.CommandContext(ctx, i.goexec, "get", url)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Dir = i.dir
-	return cmd.Run()
+	cmd := i.command(ctx, "get", url)
+	return i.run(cmd)
 }
 
 func (i *InDirCommand) GoModTidy(ctx context.Context) error {
-	cmd := exec.CommandContext(ctx, i.goexec, "mod", "tidy")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Dir = i.dir
-	return cmd.Run()
+	cmd := i.command(ctx, "mod", "tidy")
+	return i.run(cmd)
+}
+
+// GoListModules returns the output of go list -m all, the main module followed by the resolved build list.
+func (i *InDirCommand) GoListModules(ctx context.Context) ([]byte, error) {
+	var out bytes.Buffer
+	cmd := i.command(ctx, "list", "-m", "all")
+	cmd.Stdout = &out
+
+	if err := i.run(cmd); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
 }
 
+// GoToolDistList returns the platforms supported by the toolchain, in the goos/goarch notation.
+func (i *InDirCommand) GoToolDistList(ctx context.Context) ([]string, error) {
+	var out bytes.Buffer
+	cmd := i.command(ctx, "tool", "dist", "list")
+	cmd.Stdout = &out
+
+	if err := i.run(cmd); err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(out.String()), nil
+}
+
+// GoBuild builds the package in the directory as a go plugin.
 func (i *InDirCommand) GoBuild(ctx context.Context, goos string, goarch string, target string) error {
-	cmd := exec.CommandContext(ctx, i.goexec, "build", "-buildmode=plugin", "-o", target)
+	return i.goBuild(ctx, goos, goarch, "-buildmode=plugin", "-o", target)
+}
 
-	cmd.Env = append(os.Environ(),
+// GoBuildExecutable builds the main package in the directory as an executable.
+func (i *InDirCommand) GoBuildExecutable(ctx context.Context, goos string, goarch string, target string) error {
+	return i.goBuild(ctx, goos, goarch, "-o", target)
+}
+
+func (i *InDirCommand) goBuild(ctx context.Context, goos string, goarch string, args ...string) error {
+	if len(i.ldflags) > 0 {
+		args = append([]string{"-ldflags", strings.Join(i.ldflags, " ")}, args...)
+	}
+	cmd := i.command(ctx, append([]string{"build"}, args...)...)
+
+	cmd.Env = append(cmd.Env,
 		fmt.Sprintf("GOOS=%s", goos),
 		fmt.Sprintf("GOARCH=%s", goarch),
 		//fmt.Sprintf("CGO_ENABLED=1"),
 	)
 
+	return i.run(cmd)
+}
+
+// run runs the command within the resource limits, if any.
+func (i *InDirCommand) run(cmd *exec.Cmd) error {
+	if i.limits.enabled() {
+		cleanup, err := i.limits.apply(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to apply resource limits: %w", err)
+		}
+		defer cleanup()
+	}
+
+	return cmd.Run()
+}
+
+// WithLimits constrains the resources the toolchain commands may use.
+func (i *InDirCommand) WithLimits(l *Limits) *InDirCommand {
+	i.limits = l
+	return i
+}
+
+// command creates a go toolchain command in the directory, running in its own process group to kill it as a whole.
+func (i *InDirCommand) command(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, i.goexec, args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	if i.output != nil {
+		cmd.Stdout = i.output
+		cmd.Stderr = i.output
+	}
 	cmd.Dir = i.dir
+	cmd.Env = append(os.Environ(), i.env...)
+	cmd.WaitDelay = killGracePeriod
+	withProcessGroup(cmd)
 
-	return cmd.Run()
+	return cmd
 }
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package builder
+
+import "os/exec"
+
+// withProcessGroup is a no-op on platforms without process groups; cancelling the command only kills the go tool.
+func withProcessGroup(cmd *exec.Cmd) {}
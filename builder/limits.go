@@ -0,0 +1,33 @@
+package builder
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Limits constrains the resources of the go toolchain, enforced on linux by a cgroup v2 group below CgroupRoot.
+type Limits struct {
+	// MemoryBytes is the maximum amount of memory a toolchain command and its children may use. Zero means no limit.
+	MemoryBytes int64
+
+	// CPUs is the number of CPUs worth of time a toolchain command and its children may use. Zero means no limit.
+	CPUs float64
+
+	CgroupRoot string
+}
+
+func (l *Limits) enabled() bool {
+	return l != nil && (l.MemoryBytes > 0 || l.CPUs > 0)
+}
+
+// String describes the limits, mainly for logging purposes.
+func (l *Limits) String() string {
+	var parts []string
+	if l.MemoryBytes > 0 {
+		parts = append(parts, fmt.Sprintf("memory=%d", l.MemoryBytes))
+	}
+	if l.CPUs > 0 {
+		parts = append(parts, fmt.Sprintf("cpus=%.2f", l.CPUs))
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,80 @@
+//go:build linux
+
+package builder
+
+import (
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+)
+
+// cpuPeriod is the cpu.max period in microseconds against which the cpu quota is expressed.
+const cpuPeriod = 100000
+
+// Validate makes sure the cgroup root can be used and enables the memory and cpu controllers for the groups below it.
+func (l *Limits) Validate() error {
+	if !l.enabled() {
+		return nil
+	}
+
+	if _, err := os.Stat(filepath.Join(l.CgroupRoot, "cgroup.controllers")); err != nil {
+		return fmt.Errorf("%s is not a cgroup v2 group: %w", l.CgroupRoot, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(l.CgroupRoot, "cgroup.subtree_control"), []byte("+memory +cpu"), 0644); err != nil {
+		return fmt.Errorf("failed to enable the memory and cpu controllers on %s: %w", l.CgroupRoot, err)
+	}
+
+	return nil
+}
+
+// apply makes the command start in a new cgroup holding the limits and returns a function removing it again.
+func (l *Limits) apply(cmd *exec.Cmd) (func(), error) {
+	dir, err := os.MkdirTemp(l.CgroupRoot, "build-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+
+	cleanup := func() {
+		// -- make sure nothing survived the command, a cgroup can only be removed once it is empty
+		_ = os.WriteFile(filepath.Join(dir, "cgroup.kill"), []byte("1"), 0644)
+		if err := os.Remove(dir); err != nil {
+			log.Warn().Err(err).Msgf("failed to remove cgroup %s", dir)
+		}
+	}
+
+	if l.MemoryBytes > 0 {
+		if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte(fmt.Sprintf("%d", l.MemoryBytes)), 0644); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("failed to set memory limit: %w", err)
+		}
+	}
+
+	if l.CPUs > 0 {
+		quota := fmt.Sprintf("%d %d", int64(l.CPUs*cpuPeriod), cpuPeriod)
+		if err := os.WriteFile(filepath.Join(dir, "cpu.max"), []byte(quota), 0644); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("failed to set cpu limit: %w", err)
+		}
+	}
+
+	fd, err := syscall.Open(dir, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to open cgroup: %w", err)
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = fd
+
+	return func() {
+		_ = syscall.Close(fd)
+		cleanup()
+	}, nil
+}
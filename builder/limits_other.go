@@ -0,0 +1,21 @@
+//go:build !linux
+
+package builder
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// Validate fails when limits are requested, since they can only be enforced on linux.
+func (l *Limits) Validate() error {
+	if !l.enabled() {
+		return nil
+	}
+
+	return errors.New("resource limits are only supported on linux")
+}
+
+func (l *Limits) apply(cmd *exec.Cmd) (func(), error) {
+	return func() {}, nil
+}
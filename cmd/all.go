@@ -13,7 +13,7 @@ import (
 var AllCommand = &cli.Command{
 	Name:  "all",
 	Usage: "run the builder, service and api within the same process",
-	Flags: append(cmd.NatsFlags, []cli.Flag{
+	Flags: append(append(cmd.NatsFlags, []cli.Flag{
 		&cli.IntFlag{
 			Name:  "port",
 			Usage: "the port to run the api on",
@@ -30,7 +30,12 @@ var AllCommand = &cli.Command{
 			Usage: "enable the ui",
 			Value: false,
 		},
-	}...),
+		&cli.StringSliceFlag{
+			Name:    "trusted-proxy",
+			Usage:   "the addresses (ip or cidr range) of the reverse proxies in front of the api, whose X-Real-IP and X-Forwarded-For headers identify the client",
+			EnvVars: []string{"TRUSTED_PROXIES"},
+		},
+	}...), append(builderFlags, serviceFlags...)...),
 	Action: func(cCtx *cli.Context) error {
 		nc, js, err := cmd.ConnectNats(cCtx)
 		if err != nil {
@@ -27,6 +27,11 @@ The builder api exposes a rest api that can be used to manage the process of bui
 			Usage: "enable the ui",
 			Value: false,
 		},
+		&cli.StringSliceFlag{
+			Name:    "trusted-proxy",
+			Usage:   "the addresses (ip or cidr range) of the reverse proxies in front of the api, whose X-Real-IP and X-Forwarded-For headers identify the client",
+			EnvVars: []string{"TRUSTED_PROXIES"},
+		},
 	}...),
 	Action: func(cCtx *cli.Context) error {
 		nc, js, err := cmd.ConnectNats(cCtx)
@@ -40,7 +45,7 @@ The builder api exposes a rest api that can be used to manage the process of bui
 }
 
 func runApi(cCtx *cli.Context, nc *nats.Conn, js jetstream.JetStream) error {
-	a, err := api.NewApi(nc, js, cCtx.Int("port"), cCtx.Bool("ui"))
+	a, err := api.NewApi(nc, js, cCtx.Int("port"), cCtx.Bool("ui"), cCtx.StringSlice("trusted-proxy"))
 	if err != nil {
 		return err
 	}
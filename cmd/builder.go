@@ -4,12 +4,116 @@ import (
   "fmt"
   "github.com/rs/zerolog/log"
   "github.com/urfave/cli/v2"
+  wbuilder "github.com/wombatwisdom/wombat-builder/builder"
   "github.com/wombatwisdom/wombat-builder/internal/builder"
   "github.com/wombatwisdom/wombat-builder/internal/cmd"
   "github.com/wombatwisdom/wombat-builder/internal/store"
+  "github.com/wombatwisdom/wombat-builder/public/model"
+  "github.com/wombatwisdom/wombat-builder/sbom"
+  "github.com/wombatwisdom/wombat-builder/signing"
+  "os"
+  "path/filepath"
   "runtime"
+  "strings"
+  "time"
 )
 
+// builderFlags configure how builds are executed. They are shared by every command running a builder.
+var builderFlags = append([]cli.Flag{
+	&cli.DurationFlag{
+		Name:    "get-timeout",
+		Usage:   "the maximum duration of fetching a module using go get",
+		Value:   10 * time.Minute,
+		EnvVars: []string{"GET_TIMEOUT"},
+	},
+	&cli.DurationFlag{
+		Name:    "tidy-timeout",
+		Usage:   "the maximum duration of go mod tidy",
+		Value:   15 * time.Minute,
+		EnvVars: []string{"TIDY_TIMEOUT"},
+	},
+	&cli.DurationFlag{
+		Name:    "build-timeout",
+		Usage:   "the maximum duration of go build",
+		Value:   30 * time.Minute,
+		EnvVars: []string{"BUILD_TIMEOUT"},
+	},
+	&cli.Int64Flag{
+		Name:    "max-memory",
+		Usage:   "the maximum amount of memory in bytes each toolchain command may use, 0 for no limit (linux only)",
+		EnvVars: []string{"MAX_MEMORY"},
+	},
+	&cli.Float64Flag{
+		Name:    "max-cpus",
+		Usage:   "the number of cpus each toolchain command may use, 0 for no limit (linux only)",
+		EnvVars: []string{"MAX_CPUS"},
+	},
+	&cli.StringFlag{
+		Name:    "cgroup-root",
+		Usage:   "the cgroup v2 group delegated to the builder, used to enforce the resource limits",
+		Value:   "/sys/fs/cgroup/wombat-builder",
+		EnvVars: []string{"CGROUP_ROOT"},
+	},
+	&cli.StringSliceFlag{
+		Name:    "sbom-format",
+		Usage:   "the formats of the software bill of materials generated for every artifact (cyclonedx, spdx)",
+		Value:   cli.NewStringSlice(string(sbom.FormatCycloneDX)),
+		EnvVars: []string{"SBOM_FORMATS"},
+	},
+	&cli.StringSliceFlag{
+		Name:    "compression",
+		Usage:   "the encodings in which artifacts are additionally stored next to the plain binary (zstd, gzip)",
+		EnvVars: []string{"COMPRESSION"},
+	},
+	&cli.BoolFlag{
+		Name:    "bundles",
+		Usage:   "also store every artifact as a tar.gz (zip for windows) archive holding the binary and a build manifest",
+		EnvVars: []string{"BUNDLES"},
+	},
+	&cli.StringFlag{
+		Name:    "signing-key",
+		Usage:   "a PEM encoded ed25519 private key used to sign the artifacts. Artifacts are not signed when not set",
+		EnvVars: []string{"SIGNING_KEY"},
+	},
+	&cli.StringFlag{
+		Name:    "toolchain-dir",
+		Usage:   "the directory holding the go toolchains, named go<version>, next to the go on the PATH",
+		Value:   filepath.Join(os.TempDir(), "wombat-builder", "toolchains"),
+		EnvVars: []string{"TOOLCHAIN_DIR"},
+	},
+	&cli.StringFlag{
+		Name:    "toolchain-mirror",
+		Usage:   "a directory with go toolchain archives (like go1.22.5.linux-amd64.tar.gz) unpacked into the toolchain dir when needed",
+		EnvVars: []string{"TOOLCHAIN_MIRROR"},
+	},
+	&cli.BoolFlag{
+		Name:    "toolchain-download",
+		Usage:   "let the go command download the toolchains which are not available locally through GOTOOLCHAIN",
+		EnvVars: []string{"TOOLCHAIN_DOWNLOAD"},
+	},
+	&cli.StringSliceFlag{
+		Name:    "platform",
+		Usage:   "the platforms to build for, as goos/goarch. Defaults to every platform supported by the go on the PATH",
+		EnvVars: []string{"PLATFORMS"},
+	},
+	&cli.StringSliceFlag{
+		Name:    "cgo-compiler",
+		Usage:   "the C compiler to use for cgo builds for a platform, as goos/goarch=compiler. The C compiler on the PATH is used for the host platform",
+		EnvVars: []string{"CGO_COMPILERS"},
+	},
+	&cli.StringFlag{
+		Name:    "secrets-dir",
+		Usage:   "the directory holding the tokens of private libraries, one file per secret. Secrets are looked up in the WOMBAT_SECRET_<NAME> environment variables as well",
+		EnvVars: []string{"SECRETS_DIR"},
+	},
+	&cli.DurationFlag{
+		Name:    "cache-prune-interval",
+		Usage:   "the time between two prunes of the caches exceeding their maximum size",
+		Value:   15 * time.Minute,
+		EnvVars: []string{"CACHE_PRUNE_INTERVAL"},
+	},
+}, cacheFlags...)
+
 var BuilderCommand = &cli.Command{
 	Name:  "builder",
 	Usage: "run the builder",
@@ -17,14 +121,14 @@ var BuilderCommand = &cli.Command{
 The builder contains serveral workers which take up the task of building artifacts.
 The number of workers can be configured using the --workers flag and is set to the number of cpu's by default'.
     `,
-	Flags: append(cmd.NatsFlags, []cli.Flag{
+	Flags: append(append(cmd.NatsFlags, []cli.Flag{
 		&cli.IntFlag{
 			Name:    "workers",
 			Usage:   "the number of workers to run",
 			Value:   runtime.NumCPU(),
 			EnvVars: []string{"WORKERS"},
 		},
-	}...),
+	}...), builderFlags...),
 	Action: func(cCtx *cli.Context) error {
 		nc, js, err := cmd.ConnectNats(cCtx)
 		if err != nil {
@@ -42,7 +146,83 @@ The number of workers can be configured using the --workers flag and is set to t
 }
 
 func runBuilder(cCtx *cli.Context, s *store.Store) error {
-	bldr, err := builder.NewBuilder(s, cCtx.Int("workers"))
+	timeouts := builder.Timeouts{
+		Get:   cCtx.Duration("get-timeout"),
+		Tidy:  cCtx.Duration("tidy-timeout"),
+		Build: cCtx.Duration("build-timeout"),
+	}
+
+	limits := &wbuilder.Limits{
+		MemoryBytes: cCtx.Int64("max-memory"),
+		CPUs:        cCtx.Float64("max-cpus"),
+		CgroupRoot:  cCtx.String("cgroup-root"),
+	}
+
+	var formats []sbom.Format
+	for _, f := range cCtx.StringSlice("sbom-format") {
+		formats = append(formats, sbom.Format(f))
+	}
+
+	var compressions []builder.Compression
+	for _, c := range cCtx.StringSlice("compression") {
+		compressions = append(compressions, builder.Compression(c))
+	}
+
+	var signer *signing.Signer
+	if cCtx.IsSet("signing-key") {
+		var err error
+		if signer, err = signing.LoadSigner(cCtx.String("signing-key")); err != nil {
+			return err
+		}
+		log.Info().Msgf("signing artifacts, verify them using\n%s", signer.PublicKey())
+	}
+
+	var platforms []model.Platform
+	for _, p := range cCtx.StringSlice("platform") {
+		platform, err := model.ParsePlatform(p)
+		if err != nil {
+			return err
+		}
+		platforms = append(platforms, platform)
+	}
+
+	compilers := map[string]string{}
+	for _, c := range cCtx.StringSlice("cgo-compiler") {
+		p, cc, ok := strings.Cut(c, "=")
+		if !ok || cc == "" {
+			return fmt.Errorf("invalid cgo compiler %q, expected goos/goarch=compiler", c)
+		}
+
+		platform, err := model.ParsePlatform(p)
+		if err != nil {
+			return err
+		}
+		compilers[platform.String()] = cc
+	}
+
+	toolchains, err := builder.NewToolchains(cCtx.Context, cCtx.String("toolchain-dir"), cCtx.String("toolchain-mirror"), cCtx.Bool("toolchain-download"))
+	if err != nil {
+		return fmt.Errorf("failed to discover go toolchains: %w", err)
+	}
+
+	cache, err := openCache(cCtx)
+	if err != nil {
+		return err
+	}
+
+	bldr, err := builder.NewBuilder(s, cCtx.Int("workers"),
+		builder.WithTimeouts(timeouts),
+		builder.WithLimits(limits),
+		builder.WithSBOMFormats(formats...),
+		builder.WithSigner(signer),
+		builder.WithCompression(compressions...),
+		builder.WithBundles(cCtx.Bool("bundles")),
+		builder.WithToolchains(toolchains),
+		builder.WithPlatforms(platforms...),
+		builder.WithCgoCompilers(compilers),
+		builder.WithCache(cache, cCtx.Duration("cache-prune-interval")),
+		builder.WithSecrets(builder.NewSecrets(cCtx.String("secrets-dir"))),
+	)
 	if err != nil {
 		return err
 	}
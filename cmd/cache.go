@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/urfave/cli/v2"
+	wbuilder "github.com/wombatwisdom/wombat-builder/builder"
+	"os"
+	"path/filepath"
+)
+
+// cacheFlags locate the module and build cache shared by the workers of a builder.
+var cacheFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "cache-dir",
+		Usage:   "the directory holding the go module and build caches shared by all builds",
+		Value:   filepath.Join(os.TempDir(), "wombat-builder", "cache"),
+		EnvVars: []string{"CACHE_DIR"},
+	},
+	&cli.Int64Flag{
+		Name:    "mod-cache-max-size",
+		Usage:   "the maximum size in bytes of the module cache, 0 for no limit",
+		EnvVars: []string{"MOD_CACHE_MAX_SIZE"},
+	},
+	&cli.Int64Flag{
+		Name:    "build-cache-max-size",
+		Usage:   "the maximum size in bytes of the build cache, 0 for no limit",
+		EnvVars: []string{"BUILD_CACHE_MAX_SIZE"},
+	},
+}
+
+var CacheCommand = &cli.Command{
+	Name:  "cache",
+	Usage: "inspect and prune the module and build cache of a builder",
+	Subcommands: []*cli.Command{
+		{
+			Name:  "info",
+			Usage: "show the size of the caches",
+			Flags: cacheFlags,
+			Action: func(cCtx *cli.Context) error {
+				cache, err := openCache(cCtx)
+				if err != nil {
+					return err
+				}
+
+				stats, err := cache.Stats()
+				if err != nil {
+					return fmt.Errorf("failed to inspect cache: %w", err)
+				}
+
+				fmt.Printf("cache dir:    %s\n", cache.Dir)
+				fmt.Printf("module cache: %d modules, %s%s\n", stats.ModEntries, formatBytes(stats.ModSize), formatMax(cache.MaxModSize))
+				fmt.Printf("build cache:  %d entries, %s%s\n", stats.BuildEntries, formatBytes(stats.BuildSize), formatMax(cache.MaxBuildSize))
+				return nil
+			},
+		},
+		{
+			Name:  "prune",
+			Usage: "evict the oldest entries from the caches exceeding their maximum size",
+			Description: `
+Pruning waits for the builds using the cache to finish. The maximum sizes are taken from the
+--mod-cache-max-size and --build-cache-max-size flags, unless --all is given to empty the caches.
+    `,
+			Flags: append([]cli.Flag{
+				&cli.BoolFlag{
+					Name:  "all",
+					Usage: "remove everything from the caches",
+				},
+			}, cacheFlags...),
+			Action: func(cCtx *cli.Context) error {
+				cache, err := openCache(cCtx)
+				if err != nil {
+					return err
+				}
+
+				if cCtx.Bool("all") {
+					if err := cache.Clear(); err != nil {
+						return fmt.Errorf("failed to clear cache: %w", err)
+					}
+
+					fmt.Println("cleared the module and build cache")
+					return nil
+				}
+
+				report, err := cache.Prune()
+				if err != nil {
+					return fmt.Errorf("failed to prune cache: %w", err)
+				}
+
+				fmt.Printf("evicted %d modules (%s) and %d build cache entries (%s)\n", report.ModEvicted, formatBytes(report.ModFreed), report.BuildEvicted, formatBytes(report.BuildFreed))
+				return nil
+			},
+		},
+	},
+}
+
+func openCache(cCtx *cli.Context) (*wbuilder.Cache, error) {
+	cache, err := wbuilder.NewCache(cCtx.String("cache-dir"), cCtx.Int64("mod-cache-max-size"), cCtx.Int64("build-cache-max-size"))
+	if err != nil {
+		return nil, err
+	}
+
+	return cache, nil
+}
+
+func formatMax(max int64) string {
+	if max <= 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(" (max %s)", formatBytes(max))
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -8,15 +8,59 @@ import (
   "github.com/wombatwisdom/wombat-builder/internal/cmd"
   "github.com/wombatwisdom/wombat-builder/internal/service"
   "github.com/wombatwisdom/wombat-builder/internal/store"
+  "github.com/wombatwisdom/wombat-builder/library"
+  "time"
 )
 
+// serviceFlags configure the service. They are shared by every command running a service.
+var serviceFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "library-dir",
+		Usage:   "the location of the library catalog used to resolve library references in build requests",
+		Value:   "library/libraries",
+		EnvVars: []string{"LIBRARY_DIR"},
+	},
+	&cli.DurationFlag{
+		Name:    "gc-interval",
+		Usage:   "the time between two garbage collections of old builds, 0 to disable the periodic collection",
+		Value:   time.Hour,
+		EnvVars: []string{"GC_INTERVAL"},
+	},
+	&cli.IntFlag{
+		Name:    "keep-last",
+		Usage:   "the number of most recent successful builds kept for each set of packages, 0 to keep all of them",
+		EnvVars: []string{"KEEP_LAST"},
+	},
+	&cli.DurationFlag{
+		Name:    "max-idle",
+		Usage:   "remove builds which have not been downloaded for this long, 0 to keep them regardless",
+		EnvVars: []string{"MAX_IDLE"},
+	},
+	&cli.StringSliceFlag{
+		Name:    "api-user",
+		Usage:   "the nats users (as account/user) the api connects with from another account, trusted to name the requester of a build",
+		EnvVars: []string{"API_USERS"},
+	},
+	&cli.StringFlag{
+		Name:    "repo-mirror-dir",
+		Usage:   "the directory holding the bare mirrors of the registered repositories, as <name>.git. Mirrors are only read from within this directory",
+		EnvVars: []string{"REPO_MIRROR_DIR"},
+	},
+	&cli.DurationFlag{
+		Name:    "repo-sync-interval",
+		Usage:   "the time between two syncs of the registered repositories with the catalog, 0 to only sync on request",
+		Value:   5 * time.Minute,
+		EnvVars: []string{"REPO_SYNC_INTERVAL"},
+	},
+}
+
 var ServiceCommand = &cli.Command{
 	Name:  "service",
 	Usage: "run the builder service",
 	Description: `
 The service exposes a nats micro service that can be used to manage the process of building artifacts. 
 `,
-	Flags: append(cmd.NatsFlags, []cli.Flag{}...),
+	Flags: append(append(cmd.NatsFlags, []cli.Flag{}...), serviceFlags...),
 	Action: func(cCtx *cli.Context) error {
 		nc, js, err := cmd.ConnectNats(cCtx)
 		if err != nil {
@@ -34,7 +78,17 @@ The service exposes a nats micro service that can be used to manage the process
 }
 
 func runService(cCtx *cli.Context, nc *nats.Conn, s *store.Store) error {
-	svc, err := service.NewService(nc, s)
+	retention := service.RetentionPolicy{
+		KeepLast: cCtx.Int("keep-last"),
+		MaxIdle:  cCtx.Duration("max-idle"),
+		Interval: cCtx.Duration("gc-interval"),
+	}
+
+	svc, err := service.NewService(nc, s, library.NewFsClient(cCtx.String("library-dir")),
+		service.WithRetention(retention),
+		service.WithApiUsers(cCtx.StringSlice("api-user")...),
+		service.WithRepoSync(cCtx.String("repo-mirror-dir"), cCtx.Duration("repo-sync-interval")),
+	)
 	if err != nil {
 		return err
 	}
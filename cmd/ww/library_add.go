@@ -18,6 +18,26 @@ func AddLibraryCommand() *cli.Command {
 				Aliases: []string{"m"},
 				Usage:   "the module name, without the version",
 			},
+			&cli.BoolFlag{
+				Name:  "private",
+				Usage: "fetch the module directly from its origin instead of through the public proxy and checksum database",
+			},
+			&cli.StringFlag{
+				Name:  "proxy",
+				Usage: "a module proxy serving the module, tried before the default proxies",
+			},
+			&cli.StringFlag{
+				Name:  "host",
+				Usage: "the host to present the credentials to. Defaults to the host in the module name",
+			},
+			&cli.StringFlag{
+				Name:  "secret",
+				Usage: "the name of the secret on the builders holding the token to fetch the module with",
+			},
+			&cli.StringFlag{
+				Name:  "username",
+				Usage: "the user to present the token as",
+			},
 		},
 		Action: func(c *cli.Context) error {
 			GlobalLogLevelFromFlag(c)
@@ -36,6 +56,16 @@ func AddLibraryCommand() *cli.Command {
 				Module: c.String("module"),
 			}
 
+			if c.Bool("private") || c.IsSet("proxy") || c.IsSet("secret") {
+				libSpec.Access = &library.AccessSpec{
+					Private:  c.Bool("private"),
+					Proxy:    c.String("proxy"),
+					Host:     c.String("host"),
+					Secret:   c.String("secret"),
+					Username: c.String("username"),
+				}
+			}
+
 			lib := LibFromEnv()
 			if err := lib.AddLibrary(libSpec); err != nil {
 				return cli.Exit(err, 1)
@@ -22,6 +22,8 @@ func initApp() *cli.App {
 			LibraryCommand(),
 			VersionCommand(),
 			PackageCommand(),
+			SbomCommand(),
+			VerifyCommand(),
 		},
 	}
 
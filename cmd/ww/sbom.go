@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/urfave/cli/v2"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"github.com/wombatwisdom/wombat-builder/sbom"
+	"os"
+)
+
+func SbomCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "sbom",
+		Usage: "print the software bill of materials of a wombat binary",
+		Description: `
+generate a software bill of materials for a locally built wombat binary, based on the build information embedded
+into it by the go toolchain. When the output of go list -m all is provided as well, the modules which are part of
+the module graph but did not end up in the binary are listed as excluded components.
+`,
+		Args:      true,
+		ArgsUsage: " binary",
+		Flags: []cli.Flag{
+			LogFlag,
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "the format of the document, either cyclonedx or spdx",
+				Value: string(sbom.FormatCycloneDX),
+			},
+			&cli.StringFlag{
+				Name:  "modules",
+				Usage: "a file holding the output of go list -m all for the binary",
+			},
+			&cli.StringFlag{
+				Name:  "name",
+				Usage: "the name of the binary in the document",
+				Value: "github.com/wombatwisdom/wombat",
+			},
+			&cli.StringFlag{
+				Name:  "version",
+				Usage: "the version of the binary in the document",
+				Value: "local",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			GlobalLogLevelFromFlag(c)
+
+			if c.NArg() != 1 {
+				return cli.Exit("the binary must be provided", 1)
+			}
+
+			format := sbom.Format(c.String("format"))
+			if !format.Valid() {
+				return cli.Exit("format must be either cyclonedx or spdx", 1)
+			}
+
+			in, err := sbom.ReadInput(c.Args().Get(0), c.String("name"), c.String("version"))
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			if c.IsSet("modules") {
+				modules, err := os.ReadFile(c.String("modules"))
+				if err != nil {
+					return cli.Exit(err, 1)
+				}
+				in.Modules = model.ParseModuleList(modules)
+			}
+
+			if err := sbom.Write(os.Stdout, format, in); err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			return nil
+		},
+	}
+}
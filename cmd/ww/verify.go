@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"github.com/wombatwisdom/wombat-builder/signing"
+	"os"
+	"strings"
+)
+
+func VerifyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "verify",
+		Usage: "verify a downloaded wombat binary",
+		Description: `
+verify a wombat binary against the .sha256 and .sig companions served next to it. By default the companions are
+expected next to the binary, as <binary>.sha256 and <binary>.sig. The signature is only checked when a public key is
+given, either in the minisign format or as a PEM encoded ed25519 public key.
+`,
+		Args:      true,
+		ArgsUsage: " binary",
+		Flags: []cli.Flag{
+			LogFlag,
+			&cli.StringFlag{
+				Name:  "sha256",
+				Usage: "the file holding the SHA-256 digest of the binary",
+			},
+			&cli.StringFlag{
+				Name:  "sig",
+				Usage: "the file holding the signature of the binary",
+			},
+			&cli.StringFlag{
+				Name:    "public-key",
+				Aliases: []string{"p"},
+				Usage:   "the file holding the public key of the builder",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			GlobalLogLevelFromFlag(c)
+
+			if c.NArg() != 1 {
+				return cli.Exit("the binary must be provided", 1)
+			}
+			binary := c.Args().Get(0)
+
+			digestFile := binary + ".sha256"
+			if c.IsSet("sha256") {
+				digestFile = c.String("sha256")
+			}
+
+			if err := verifyDigest(binary, digestFile); err != nil {
+				return cli.Exit(err, 1)
+			}
+			fmt.Println("digest ok")
+
+			if !c.IsSet("public-key") {
+				return nil
+			}
+
+			sigFile := binary + ".sig"
+			if c.IsSet("sig") {
+				sigFile = c.String("sig")
+			}
+
+			if err := verifySignature(binary, sigFile, c.String("public-key")); err != nil {
+				return cli.Exit(err, 1)
+			}
+			fmt.Println("signature ok")
+
+			return nil
+		},
+	}
+}
+
+func verifyDigest(binary string, digestFile string) error {
+	expected, err := os.ReadFile(digestFile)
+	if err != nil {
+		return fmt.Errorf("failed to read digest: %w", err)
+	}
+
+	// -- the digest file is in the sha256sum format, so only the first field holds the digest
+	fields := strings.Fields(string(expected))
+	if len(fields) == 0 {
+		return fmt.Errorf("digest file %s is empty", digestFile)
+	}
+
+	f, err := os.Open(binary)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	actual, err := signing.Sha256(f)
+	if err != nil {
+		return fmt.Errorf("failed to compute digest: %w", err)
+	}
+
+	if !strings.EqualFold(actual, fields[0]) {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", fields[0], actual)
+	}
+
+	return nil
+}
+
+func verifySignature(binary string, sigFile string, keyFile string) error {
+	keyData, err := os.ReadFile(keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read public key: %w", err)
+	}
+
+	key, err := signing.ParsePublicKey(bytes.TrimSpace(keyData))
+	if err != nil {
+		return err
+	}
+
+	sig, err := os.ReadFile(sigFile)
+	if err != nil {
+		return fmt.Errorf("failed to read signature: %w", err)
+	}
+
+	f, err := os.Open(binary)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return key.Verify(f, sig)
+}
@@ -3,17 +3,24 @@ package api
 import (
 	"context"
 	"embed"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nats.go/micro"
 	"github.com/rs/zerolog/log"
+	"github.com/wombatwisdom/wombat-builder/internal/shared"
 	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"github.com/wombatwisdom/wombat-builder/public/model"
 	"io"
 	"io/fs"
 	"net/http"
+	"net/netip"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -23,21 +30,47 @@ var web embed.FS
 type Api struct {
 	port      int
 	nc        *nats.Conn
+	js        jetstream.JetStream
 	artifacts jetstream.ObjectStore
+	logs      *store.BuildLogs
+	downloads *store.Downloads
 	enableUi  bool
+
+	// trustedProxies are the proxies whose forwarding headers tell who sent a request
+	trustedProxies []netip.Prefix
 }
 
-func NewApi(nc *nats.Conn, js jetstream.JetStream, port int, enableUi bool) (*Api, error) {
+func NewApi(nc *nats.Conn, js jetstream.JetStream, port int, enableUi bool, trustedProxies []string) (*Api, error) {
+	proxies, err := parseProxies(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
 	artifacts, err := js.ObjectStore(context.Background(), store.JetstreamOSArtifacts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create object store: %w", err)
 	}
 
+	logs, err := store.NewBuildLogs(context.Background(), js)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open build logs: %w", err)
+	}
+
+	downloads, err := store.NewDownloads(context.Background(), js)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open downloads: %w", err)
+	}
+
 	return &Api{
 		port:      port,
 		nc:        nc,
+		js:        js,
 		artifacts: artifacts,
+		logs:      logs,
+		downloads: downloads,
 		enableUi:  enableUi,
+
+		trustedProxies: proxies,
 	}, nil
 }
 
@@ -54,6 +87,7 @@ func (a *Api) Run(ctx context.Context) error {
 	router := mux.NewRouter()
 
 	ar := router.PathPrefix("/api").Subrouter().StrictSlash(true)
+	ar.Use(a.identifyRequester)
 	ar.Use(func(inner http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
@@ -81,6 +115,8 @@ func (a *Api) Run(ctx context.Context) error {
 
 	buildRouter := ar.PathPrefix("/builds").Subrouter()
 	buildRouter.Handle("", createHandlerFunc(a.nc, "build.request")).Methods(http.MethodPost)
+	buildRouter.Handle("/matrix", createHandlerFunc(a.nc, "build.matrix")).Methods(http.MethodPost)
+	buildRouter.Handle("/groups/{id}", createHandlerFuncWithCallback(a.nc, "build.group", buildIdRequest)).Methods(http.MethodGet)
 	buildRouter.Handle("", createHandlerFuncWithCallback(a.nc, "build.list", func(r *http.Request) ([]byte, error) {
 		q, err := url.QueryUnescape(r.URL.Query().Get("q"))
 		if err != nil {
@@ -89,12 +125,66 @@ func (a *Api) Run(ctx context.Context) error {
 
 		return []byte(fmt.Sprintf("{\"query\": \"%s\"}", q)), nil
 	})).Methods(http.MethodGet)
+	buildRouter.Handle("/{id}", createHandlerFuncWithCallback(a.nc, "build.get", buildIdRequest)).Methods(http.MethodGet)
+	buildRouter.Handle("/{id}", createHandlerFuncWithCallback(a.nc, "build.cancel", buildIdRequest)).Methods(http.MethodDelete)
+	buildRouter.Handle("/{id}/events", createStreamHandlerFunc(a.nc, "build.watch", "build", buildIdRequest)).Methods(http.MethodGet)
+	buildRouter.Handle("/{id}/logs", createLogHandler(a.nc, a.logs)).Methods(http.MethodGet)
+	buildRouter.Handle("/{id}/sbom", createSbomHandler(a.nc, a.js, a.artifacts)).Methods(http.MethodGet, http.MethodHead)
+	buildRouter.Handle("/{id}/modules", createHandlerFuncWithCallback(a.nc, "build.modules", buildIdRequest)).Methods(http.MethodGet)
 
-	artifactRouter := router.PathPrefix("/artifacts").Subrouter()
-	artifactRouter.Handle("/{arch}/{os}/{ver}/{hash}", createObjectReader(a.artifacts, func(r *http.Request) string {
+	profileRouter := ar.PathPrefix("/profiles").Subrouter()
+	profileRouter.Handle("", createHandlerFunc(a.nc, "profiles.create")).Methods(http.MethodPost)
+	profileRouter.Handle("", createHandlerFunc(a.nc, "profiles.list")).Methods(http.MethodGet)
+	profileRouter.Handle("/{name}", createHandlerFuncWithCallback(a.nc, "profiles.get", func(r *http.Request) ([]byte, error) {
+		req := map[string]interface{}{"name": mux.Vars(r)["name"]}
+		if v := r.URL.Query().Get("version"); v != "" {
+			version, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, err
+			}
+			req["version"] = version
+		}
+
+		return json.Marshal(req)
+	})).Methods(http.MethodGet)
+	profileRouter.Handle("/{name}", createHandlerFuncWithCallback(a.nc, "profiles.update", bodyWithPathField("name", "name"))).Methods(http.MethodPut)
+	profileRouter.Handle("/{name}", createHandlerFuncWithCallback(a.nc, "profiles.delete", nameRequest)).Methods(http.MethodDelete)
+	profileRouter.Handle("/{name}/builds", createHandlerFuncWithCallback(a.nc, "build.profile", bodyWithPathField("name", "profile"))).Methods(http.MethodPost)
+
+	repoRouter := ar.PathPrefix("/repos").Subrouter()
+	repoRouter.Handle("", createHandlerFunc(a.nc, "repos.register")).Methods(http.MethodPost)
+	repoRouter.Handle("", createHandlerFunc(a.nc, "repos.list")).Methods(http.MethodGet)
+	repoRouter.Handle("/{name}", createHandlerFuncWithCallback(a.nc, "repos.get", nameRequest)).Methods(http.MethodGet)
+	repoRouter.Handle("/{name}", createHandlerFuncWithCallback(a.nc, "repos.delete", nameRequest)).Methods(http.MethodDelete)
+	repoRouter.Handle("/{name}/sync", createHandlerFuncWithCallback(a.nc, "repos.sync", nameRequest)).Methods(http.MethodPost)
+
+	ar.Handle("/stats", createHandlerFuncWithCallback(a.nc, "stats", func(r *http.Request) ([]byte, error) {
+		req := map[string]int{}
+		if l := r.URL.Query().Get("limit"); l != "" {
+			limit, err := strconv.Atoi(l)
+			if err != nil {
+				return nil, err
+			}
+			req["limit"] = limit
+		}
+
+		return json.Marshal(req)
+	})).Methods(http.MethodGet)
+
+	artifactId := func(r *http.Request) string {
 		params := mux.Vars(r)
 		return fmt.Sprintf("build.%s.%s.%s.%s", params["arch"], params["os"], params["ver"], params["hash"])
-	})).Methods(http.MethodGet)
+	}
+
+	// -- the companions need to be registered first, otherwise the artifact route would match them as well
+	artifactRouter := router.PathPrefix("/artifacts").Subrouter()
+	artifactRouter.Handle("/{arch}/{os}/{ver}/{hash:[^.]+}.tar.gz", createBundleReader(a.js, a.artifacts, a.downloads, artifactId, store.TarGzSuffix, "application/gzip")).Methods(http.MethodGet, http.MethodHead)
+	artifactRouter.Handle("/{arch}/{os}/{ver}/{hash:[^.]+}.zip", createBundleReader(a.js, a.artifacts, a.downloads, artifactId, store.ZipSuffix, "application/zip")).Methods(http.MethodGet, http.MethodHead)
+	artifactRouter.Handle("/{arch}/{os}/{ver}/{hash:[^.]+}.sha256", createDigestReader(a.artifacts, artifactId)).Methods(http.MethodGet)
+	artifactRouter.Handle("/{arch}/{os}/{ver}/{hash:[^.]+}.sig", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveObject(w, r, a.js, a.artifacts, artifactId(r)+store.SignatureSuffix, "text/plain", artifactFilename(artifactId(r))+".sig")
+	})).Methods(http.MethodGet, http.MethodHead)
+	artifactRouter.Handle("/{arch}/{os}/{ver}/{hash}", createObjectReader(a.js, a.artifacts, a.downloads, artifactId)).Methods(http.MethodGet, http.MethodHead)
 
 	if a.enableUi {
 		dist, err := fs.Sub(web, "web/dist")
@@ -139,51 +229,127 @@ func createHandlerFuncWithCallback(nc *nats.Conn, endpoint string, cb func(r *ht
 			return
 		}
 
-		resp, err := nc.Request(endpoint, b, 10*time.Second)
+		msg := nats.NewMsg(endpoint)
+		msg.Data = b
+		if requester := requesterOf(r); requester != "" {
+			msg.Header.Set(shared.RequesterHeader, requester)
+		}
+
+		resp, err := nc.RequestMsg(msg, 10*time.Second)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			_, _ = w.Write([]byte(err.Error()))
 			return
 		}
-		w.WriteHeader(http.StatusOK)
 		for h, v := range resp.Header {
 			w.Header().Set(h, v[0])
 		}
+		w.WriteHeader(responseStatus(resp))
 		_, _ = w.Write(resp.Data)
 	}
 }
 
-func createObjectReader(obj jetstream.ObjectStore, idCb func(r *http.Request) string) http.HandlerFunc {
+// responseStatus maps the error code of a service response onto the http status returned to the client.
+func responseStatus(resp *nats.Msg) int {
+	switch resp.Header.Get(micro.ErrorCodeHeader) {
+	case "":
+		return http.StatusOK
+	case "BAD_REQUEST":
+		return http.StatusBadRequest
+	case "NOT_FOUND":
+		return http.StatusNotFound
+	case "CONFLICT":
+		return http.StatusConflict
+	case "BACKBONE_ERROR":
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// buildIdRequest creates the body for service requests that only need the id of the build from the path.
+func buildIdRequest(r *http.Request) ([]byte, error) {
+	return json.Marshal(map[string]string{"id": mux.Vars(r)["id"]})
+}
+
+// nameRequest creates the body for service requests that only need the name from the path.
+func nameRequest(r *http.Request) ([]byte, error) {
+	return json.Marshal(map[string]string{"name": mux.Vars(r)["name"]})
+}
+
+// bodyWithPathField creates the body for service requests from the request body and a path variable.
+func bodyWithPathField(variable string, field string) func(r *http.Request) ([]byte, error) {
+	return func(r *http.Request) ([]byte, error) {
+		req := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			return nil, err
+		}
+		req[field] = mux.Vars(r)[variable]
+
+		return json.Marshal(req)
+	}
+}
+
+// createObjectReader serves an artifact, or a compressed copy of it when the client accepts one.
+func createObjectReader(js jetstream.JetStream, obj jetstream.ObjectStore, downloads *store.Downloads, idCb func(r *http.Request) string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := idCb(r)
 
-		or, err := obj.Get(r.Context(), id)
+		w.Header().Add("Vary", "Accept-Encoding")
+		name, encoding := negotiateEncoding(r, obj, id)
+		if encoding != "" {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+
+		n := serveObject(w, r, js, obj, name, "application/octet-stream", artifactFilename(id))
+		recordDownload(r, downloads, id, name, n)
+	}
+}
+
+// createBundleReader serves the archive bundling an artifact with its license and manifest.
+func createBundleReader(js jetstream.JetStream, obj jetstream.ObjectStore, downloads *store.Downloads, idCb func(r *http.Request) string, suffix string, contentType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := idCb(r)
+		n := serveObject(w, r, js, obj, id+suffix, contentType, strings.TrimSuffix(artifactFilename(id), ".exe")+suffix)
+		recordDownload(r, downloads, id, id+suffix, n)
+	}
+}
+
+// recordDownload stores a download event when a request starts downloading the object, so each counts once.
+func recordDownload(r *http.Request, downloads *store.Downloads, id string, object string, n int64) {
+	if n == 0 || !startsDownload(r) {
+		return
+	}
+
+	err := downloads.Record(r.Context(), model.DownloadEvent{
+		BuildId:   id,
+		Object:    object,
+		Timestamp: time.Now().UTC(),
+		UserAgent: r.UserAgent(),
+		Bytes:     n,
+	})
+	if err != nil {
+		log.Warn().Err(err).Msgf("failed to record download of %s", object)
+	}
+}
+
+// createDigestReader serves the SHA-256 digest of an artifact in the format used by sha256sum.
+func createDigestReader(obj jetstream.ObjectStore, idCb func(r *http.Request) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := idCb(r)
+		digest, err := obj.GetString(r.Context(), id+store.Sha256Suffix)
 		if err != nil {
 			if errors.Is(err, jetstream.ErrObjectNotFound) {
 				w.WriteHeader(http.StatusNotFound)
 			} else {
 				w.WriteHeader(http.StatusInternalServerError)
-				w.Write([]byte(err.Error()))
+				_, _ = w.Write([]byte(err.Error()))
 			}
 
 			return
 		}
-		defer or.Close()
-
-		oi, err := or.Info()
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
-			return
-		}
 
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", oi.Size))
-		w.Header().Set("Content-Type", "application/octet-stream")
-		w.Header().Set("Content-Disposition", "attachment; filename=\"wombat\"")
-		if _, err := io.Copy(w, or); err != nil {
-			log.Err(err).Msgf("failed to write object %s", id)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
-		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(fmt.Sprintf("%s  %s\n", digest, artifactFilename(id))))
 	}
 }
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// encodings lists the content encodings artifacts may be stored in, in order of preference.
+var encodings = []struct {
+	name   string
+	suffix string
+}{
+	{"zstd", store.ZstdSuffix},
+	{"gzip", store.GzipSuffix},
+}
+
+// negotiateEncoding picks the object name and content encoding to serve based on the Accept-Encoding header.
+func negotiateEncoding(r *http.Request, obj jetstream.ObjectStore, id string) (string, string) {
+	accepted := parseAcceptEncoding(r.Header.Get("Accept-Encoding"))
+
+	for _, enc := range encodings {
+		q, fnd := accepted[enc.name]
+		if !fnd {
+			q = accepted["*"]
+		}
+
+		if q <= 0 {
+			continue
+		}
+
+		// -- not every artifact is stored in every encoding
+		if _, err := obj.GetInfo(r.Context(), id+enc.suffix); err != nil {
+			continue
+		}
+
+		return id + enc.suffix, enc.name
+	}
+
+	return id, ""
+}
+
+// parseAcceptEncoding returns the quality of every coding in the header. Codings without a quality get 1.
+func parseAcceptEncoding(header string) map[string]float64 {
+	result := map[string]float64{}
+
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+
+		q := 1.0
+		if name, value, fnd := strings.Cut(strings.TrimSpace(params), "="); fnd && strings.TrimSpace(name) == "q" {
+			if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = v
+			}
+		}
+
+		result[coding] = q
+	}
+
+	return result
+}
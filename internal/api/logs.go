@@ -0,0 +1,43 @@
+package api
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"net/http"
+)
+
+// createLogHandler returns the build log, streamed as Server-Sent Events when the follow parameter is set.
+func createLogHandler(nc *nats.Conn, logs *store.BuildLogs) http.HandlerFunc {
+	fetch := createHandlerFuncWithCallback(nc, "build.logs", buildIdRequest)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.Query().Has("follow") {
+			fetch(w, r)
+			return
+		}
+
+		id := mux.Vars(r)["id"]
+
+		sse, err := newSseWriter(w)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		err = logs.Follow(r.Context(), id, func(line string) error {
+			return sse.Send("", line)
+		})
+		if err != nil {
+			if r.Context().Err() == nil {
+				log.Warn().Err(err).Msgf("failed to follow log of %s", id)
+				_ = sse.Send("error", err.Error())
+			}
+			return
+		}
+
+		_ = sse.Send("end", "")
+	}
+}
@@ -0,0 +1,326 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog/log"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// serveObject serves the object, verifying its digest unless a range is read, and returns the bytes served.
+func serveObject(w http.ResponseWriter, r *http.Request, js jetstream.JetStream, obj jetstream.ObjectStore, id string, contentType string, filename string) int64 {
+	oi, err := obj.GetInfo(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrObjectNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(err.Error()))
+		}
+
+		return 0
+	}
+
+	rs := &objectReadSeeker{ctx: r.Context(), js: js, info: oi}
+	defer rs.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if oi.Digest != "" {
+		w.Header().Set("ETag", fmt.Sprintf("%q", strings.TrimPrefix(oi.Digest, "SHA-256=")))
+	}
+
+	// -- ServeContent takes care of ranges, If-None-Match, If-Modified-Since and HEAD
+	http.ServeContent(w, r, filename, oi.ModTime, rs)
+	if rs.err != nil {
+		log.Err(rs.err).Msgf("failed to write object %s", id)
+		return rs.served
+	}
+
+	// -- the garbage collection uses the last download to decide whether an artifact is still in use
+	if rs.served > 0 && startsDownload(r) {
+		if err := store.MarkDownloaded(r.Context(), obj, oi); err != nil {
+			log.Warn().Err(err).Msgf("failed to record download of %s", id)
+		}
+	}
+
+	return rs.served
+}
+
+// startsDownload tells whether the request asks for the object from its first byte onwards.
+func startsDownload(r *http.Request) bool {
+	ranges := r.Header.Get("Range")
+	if ranges == "" {
+		return true
+	}
+
+	spec, ok := strings.CutPrefix(strings.TrimSpace(ranges), "bytes=")
+	if !ok {
+		return false
+	}
+
+	first, _, _ := strings.Cut(spec, ",")
+	start, _, _ := strings.Cut(strings.TrimSpace(first), "-")
+	return start == "0"
+}
+
+// artifactFilename turns the id of a build into the name of the file users download, like wombat_linux_amd64_<hash>.
+func artifactFilename(id string) string {
+	parts := strings.Split(id, ".")
+	if len(parts) != 5 {
+		return "wombat"
+	}
+
+	name := fmt.Sprintf("wombat_%s_%s_%s", parts[1], parts[2], parts[4])
+	if parts[1] == "windows" {
+		name += ".exe"
+	}
+
+	return name
+}
+
+// objectReadSeeker makes an object seekable by starting to read at the chunk holding the offset.
+type objectReadSeeker struct {
+	ctx  context.Context
+	js   jetstream.JetStream
+	info *jetstream.ObjectInfo
+
+	reader *chunkReader
+	offset int64 // the position of the reader
+	pos    int64 // the position requested by the caller
+	served int64 // the number of bytes of content read
+	err    error
+}
+
+func (o *objectReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = o.pos + offset
+	case io.SeekEnd:
+		pos = int64(o.info.Size) + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if pos < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	o.pos = pos
+	return pos, nil
+}
+
+func (o *objectReadSeeker) Read(p []byte) (int, error) {
+	if o.pos >= int64(o.info.Size) {
+		return 0, io.EOF
+	}
+
+	// -- a reader which would have to skip over whole chunks is replaced by one starting at the right chunk
+	if o.reader == nil || o.pos < o.offset || o.pos-o.offset >= o.chunkSize() {
+		if err := o.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if o.pos > o.offset {
+		n, err := io.CopyN(io.Discard, o.reader, o.pos-o.offset)
+		o.offset += n
+		if err != nil {
+			o.err = err
+			return 0, err
+		}
+	}
+
+	n, err := o.reader.Read(p)
+	o.served += int64(n)
+	o.offset += int64(n)
+	o.pos = o.offset
+	if err != nil && !errors.Is(err, io.EOF) {
+		o.err = err
+	}
+
+	return n, err
+}
+
+func (o *objectReadSeeker) chunkSize() int64 {
+	if o.info.Opts == nil || o.info.Opts.ChunkSize == 0 {
+		return defaultChunkSize
+	}
+
+	return int64(o.info.Opts.ChunkSize)
+}
+
+// open starts reading at the chunk holding the requested position.
+func (o *objectReadSeeker) open() error {
+	_ = o.Close()
+
+	chunk := o.pos / o.chunkSize()
+	reader, err := openChunks(o.ctx, o.js, o.info, int(chunk))
+	if err != nil {
+		o.err = err
+		return err
+	}
+
+	o.reader = reader
+	o.offset = chunk * o.chunkSize()
+	return nil
+}
+
+func (o *objectReadSeeker) Close() error {
+	if o.reader == nil {
+		return nil
+	}
+
+	err := o.reader.Close()
+	o.reader = nil
+	return err
+}
+
+// defaultChunkSize is the chunk size the object store uses when objects do not record one.
+const defaultChunkSize = 128 * 1024
+
+// chunkReader reads an object from one of its chunks onwards, consuming the stream backing the object store.
+type chunkReader struct {
+	msgs      jetstream.MessagesContext
+	stop      func() bool
+	remaining int // the number of chunks left to read
+	buf       []byte
+
+	// digest hashes the content when reading from the first chunk, to verify it against want
+	digest hash.Hash
+	want   string
+}
+
+func openChunks(ctx context.Context, js jetstream.JetStream, info *jetstream.ObjectInfo, first int) (*chunkReader, error) {
+	stream := fmt.Sprintf("OBJ_%s", info.Bucket)
+	cfg := jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{fmt.Sprintf("$O.%s.C.%s", info.Bucket, info.NUID)},
+	}
+
+	if first > 0 {
+		seq, err := chunkSequence(ctx, js, stream, cfg, first)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find chunk %d: %w", first, err)
+		}
+
+		cfg.DeliverPolicy = jetstream.DeliverByStartSequencePolicy
+		cfg.OptStartSeq = seq
+	}
+
+	msgs, stop, err := consumeChunks(ctx, js, stream, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &chunkReader{msgs: msgs, stop: stop, remaining: int(info.Chunks) - first}
+	if first == 0 && info.Digest != "" {
+		c.digest, c.want = sha256.New(), info.Digest
+	}
+
+	return c, nil
+}
+
+// chunkSequence finds the stream sequence of a chunk, reading only the headers of the chunks in front of it.
+func chunkSequence(ctx context.Context, js jetstream.JetStream, stream string, cfg jetstream.OrderedConsumerConfig, chunk int) (uint64, error) {
+	cfg.HeadersOnly = true
+	msgs, stop, err := consumeChunks(ctx, js, stream, cfg)
+	if err != nil {
+		return 0, err
+	}
+	defer stop()
+	defer msgs.Stop()
+
+	for i := 0; ; i++ {
+		msg, err := msgs.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		if i < chunk {
+			continue
+		}
+
+		meta, err := msg.Metadata()
+		if err != nil {
+			return 0, err
+		}
+
+		return meta.Sequence.Stream, nil
+	}
+}
+
+// consumeChunks starts consuming the chunks selected by the config until the context is done.
+func consumeChunks(ctx context.Context, js jetstream.JetStream, stream string, cfg jetstream.OrderedConsumerConfig) (jetstream.MessagesContext, func() bool, error) {
+	cons, err := js.OrderedConsumer(ctx, stream, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msgs, err := cons.Messages()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return msgs, context.AfterFunc(ctx, msgs.Stop), nil
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		if c.remaining <= 0 {
+			return 0, io.EOF
+		}
+
+		msg, err := c.msgs.Next()
+		if err != nil {
+			return 0, err
+		}
+		c.buf = msg.Data()
+		c.remaining--
+
+		// -- the last chunk is held back when the content does not match, so the client never gets a complete object
+		if c.digest != nil {
+			c.digest.Write(c.buf)
+			if c.remaining == 0 {
+				if err := c.verify(); err != nil {
+					c.buf = nil
+					return 0, err
+				}
+			}
+		}
+	}
+
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// verify compares the digest of the content read with the one recorded for the object.
+func (c *chunkReader) verify() error {
+	want, err := jetstream.DecodeObjectDigest(c.want)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(c.digest.Sum(nil), want) {
+		return jetstream.ErrDigestMismatch
+	}
+
+	return nil
+}
+
+func (c *chunkReader) Close() error {
+	c.stop()
+	c.msgs.Stop()
+	return nil
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// requesterKey is the context key under which the requester of an http request is kept.
+type requesterKey struct{}
+
+// parseProxies parses the addresses of the trusted proxies, given as an ip or a cidr range.
+func parseProxies(proxies []string) ([]netip.Prefix, error) {
+	var result []netip.Prefix
+	for _, p := range proxies {
+		if addr, err := netip.ParseAddr(p); err == nil {
+			result = append(result, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q, expected an ip or a cidr range", p)
+		}
+		result = append(result, prefix)
+	}
+
+	return result, nil
+}
+
+// identifyRequester records who sent the request in its context, so it can be passed on to the service.
+func (a *Api) identifyRequester(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), requesterKey{}, a.requester(r))
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requester identifies the http client by its address, or the one a trusted proxy forwards the request for.
+func (a *Api) requester(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !a.trustedProxy(addr.Unmap()) {
+		return host
+	}
+
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+
+	// -- the last address is the one added by the proxy itself, the ones in front of it are up to the client
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return strings.TrimSpace(fwd[strings.LastIndexByte(fwd, ',')+1:])
+	}
+
+	return host
+}
+
+func (a *Api) trustedProxy(addr netip.Addr) bool {
+	for _, p := range a.trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requesterOf returns the requester recorded by identifyRequester.
+func requesterOf(r *http.Request) string {
+	requester, _ := r.Context().Value(requesterKey{}).(string)
+	return requester
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"github.com/wombatwisdom/wombat-builder/sbom"
+	"net/http"
+	"time"
+)
+
+// createSbomHandler serves the SBOM of a build, in the cyclonedx (default) or spdx format.
+func createSbomHandler(nc *nats.Conn, js jetstream.JetStream, obj jetstream.ObjectStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		format := sbom.Format(r.URL.Query().Get("format"))
+		if format == "" {
+			format = sbom.FormatCycloneDX
+		}
+
+		if !format.Valid() {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("unsupported sbom format %q", format)))
+			return
+		}
+
+		// -- the build knows where its bills of materials are stored
+		body, err := buildIdRequest(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		resp, err := nc.Request("build.get", body, 10*time.Second)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		if status := responseStatus(resp); status != http.StatusOK {
+			w.WriteHeader(status)
+			_, _ = w.Write(resp.Data)
+			return
+		}
+
+		var result struct {
+			Build model.Build `json:"build"`
+		}
+		if err := json.Unmarshal(resp.Data, &result); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		var ref model.ArtifactReference
+		if result.Build.SBOM != nil {
+			ref = result.Build.SBOM.CycloneDX
+			if format == sbom.FormatSPDX {
+				ref = result.Build.SBOM.SPDX
+			}
+		}
+
+		if ref == "" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(fmt.Sprintf("no %s sbom for build %s", format, id)))
+			return
+		}
+
+		serveObject(w, r, js, obj, string(ref), "application/json", fmt.Sprintf("%s.%s", artifactFilename(id), format.Extension()))
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"errors"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/rs/zerolog/log"
+	"github.com/wombatwisdom/wombat-builder/internal/shared"
+	"net/http"
+	"time"
+)
+
+// createStreamHandlerFunc forwards the responses of a streaming endpoint as Server-Sent Events until it ends.
+func createStreamHandlerFunc(nc *nats.Conn, endpoint string, event string, cb func(r *http.Request) ([]byte, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b, err := cb(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		inbox := nc.NewRespInbox()
+		sub, err := nc.SubscribeSync(inbox)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+		defer sub.Unsubscribe()
+
+		if err := nc.PublishRequest(endpoint, inbox, b); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		// -- the first response tells us whether the stream got started at all
+		msg, err := sub.NextMsg(10 * time.Second)
+		if err != nil {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		if msg.Header.Get("Status") == "503" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(nats.ErrNoResponders.Error()))
+			return
+		}
+
+		if status := responseStatus(msg); status != http.StatusOK {
+			w.WriteHeader(status)
+			_, _ = w.Write(msg.Data)
+			return
+		}
+
+		sse, err := newSseWriter(w)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		for {
+			switch {
+			case msg.Header.Get(shared.HeartbeatHeader) != "":
+				// -- heartbeats only ask whether we are still listening, the client never sees them
+				_ = msg.Respond(nil)
+			case len(msg.Data) == 0:
+				_ = sse.Send("end", "")
+				return
+			case msg.Header.Get(micro.ErrorCodeHeader) != "":
+				_ = sse.Send("error", msg.Header.Get(micro.ErrorHeader))
+				return
+			default:
+				if err := sse.Send(event, string(msg.Data)); err != nil {
+					return
+				}
+			}
+
+			msg, err = sub.NextMsgWithContext(r.Context())
+			if err != nil {
+				if !errors.Is(err, r.Context().Err()) {
+					log.Warn().Err(err).Msgf("failed to receive from %s", endpoint)
+				}
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// defaultGoProxy is the proxy setting of the go toolchain when GOPROXY is not set.
+const defaultGoProxy = "https://proxy.golang.org,direct"
+
+// defaultUsername goes with a token when the library names no user; most git hosts accept any for tokens.
+const defaultUsername = "oauth2"
+
+// Secrets looks up secrets in the files of the secrets directory, or the WOMBAT_SECRET_<NAME> variables.
+type Secrets struct {
+	dir string
+}
+
+func NewSecrets(dir string) *Secrets {
+	return &Secrets{dir: dir}
+}
+
+// Lookup returns the value of the named secret.
+func (s *Secrets) Lookup(name string) (string, error) {
+	if s != nil && s.dir != "" {
+		b, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err == nil {
+			return strings.TrimSpace(string(b)), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read secret %s: %w", name, err)
+		}
+	}
+
+	env := "WOMBAT_SECRET_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	if v, fnd := os.LookupEnv(env); fnd && v != "" {
+		return v, nil
+	}
+
+	return "", fmt.Errorf("secret %s not found", name)
+}
+
+// moduleAccess holds what the toolchain needs to reach the private modules of a build.
+type moduleAccess struct {
+	// Env holds the environment variables to run the toolchain with.
+	Env []string
+
+	// Secrets holds the secret values which must not show up in the output or errors of the build.
+	Secrets []string
+
+	dir string
+}
+
+// prepareAccess points the toolchain at a netrc file and git credential store holding the module credentials.
+func prepareAccess(access []model.ModuleAccess, secrets *Secrets) (*moduleAccess, error) {
+	result := &moduleAccess{}
+	if len(access) == 0 {
+		return result, nil
+	}
+
+	var private, nosum, proxies []string
+	var netrc, credentials bytes.Buffer
+	for _, a := range access {
+		switch {
+		case a.Private && a.Proxy == "":
+			private = append(private, a.Module)
+		case a.Private:
+			nosum = append(nosum, a.Module)
+		}
+
+		if a.Proxy != "" {
+			proxies = append(proxies, a.Proxy)
+		}
+
+		if a.Secret == "" {
+			continue
+		}
+
+		token, err := secrets.Lookup(a.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get credentials for %s: %w", a.Module, err)
+		}
+		result.Secrets = append(result.Secrets, token)
+
+		username := a.Username
+		if username == "" {
+			username = defaultUsername
+		}
+
+		host := a.Host
+		if host == "" {
+			host, _, _ = strings.Cut(a.Module, "/")
+		}
+
+		hosts := []string{host}
+		if u, err := url.Parse(a.Proxy); err == nil && u.Host != "" && u.Host != host {
+			hosts = append(hosts, u.Host)
+		}
+
+		for _, h := range hosts {
+			fmt.Fprintf(&netrc, "machine %s login %s password %s\n", h, username, token)
+		}
+
+		creds := url.URL{Scheme: "https", User: url.UserPassword(username, token), Host: host}
+		fmt.Fprintln(&credentials, creds.String())
+	}
+
+	if len(private) > 0 {
+		result.Env = append(result.Env, fmt.Sprintf("GOPRIVATE=%s", joinEnv("GOPRIVATE", private)))
+	}
+
+	// -- modules marked as private are not known to the checksum database, no matter where they are fetched from
+	if len(nosum) > 0 || len(private) > 0 {
+		result.Env = append(result.Env, fmt.Sprintf("GONOSUMDB=%s", joinEnv("GONOSUMDB", append(nosum, private...))))
+	}
+
+	if len(proxies) > 0 {
+		fallback := os.Getenv("GOPROXY")
+		if fallback == "" {
+			fallback = defaultGoProxy
+		}
+		result.Env = append(result.Env, fmt.Sprintf("GOPROXY=%s,%s", strings.Join(proxies, ","), fallback))
+	}
+
+	if netrc.Len() == 0 {
+		return result, nil
+	}
+
+	dir, err := os.MkdirTemp("", "wombat-access-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create credentials dir: %w", err)
+	}
+	result.dir = dir
+
+	netrcFile, credentialsFile := filepath.Join(dir, ".netrc"), filepath.Join(dir, ".git-credentials")
+	if err := os.WriteFile(netrcFile, netrc.Bytes(), 0600); err != nil {
+		result.Close()
+		return nil, fmt.Errorf("failed to write netrc: %w", err)
+	}
+	if err := os.WriteFile(credentialsFile, credentials.Bytes(), 0600); err != nil {
+		result.Close()
+		return nil, fmt.Errorf("failed to write git credentials: %w", err)
+	}
+
+	result.Env = append(result.Env,
+		fmt.Sprintf("NETRC=%s", netrcFile),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=credential.helper",
+		fmt.Sprintf("GIT_CONFIG_VALUE_0=store --file=%s", credentialsFile),
+	)
+
+	return result, nil
+}
+
+// Close removes the credential files.
+func (a *moduleAccess) Close() {
+	if a.dir != "" {
+		_ = os.RemoveAll(a.dir)
+	}
+}
+
+// Redact replaces the secrets in s.
+func (a *moduleAccess) Redact(s string) string {
+	return redact(s, a.Secrets)
+}
+
+// RedactError hides the secrets from the message of err, keeping err itself in the chain.
+func (a *moduleAccess) RedactError(err error) error {
+	if err == nil || len(a.Secrets) == 0 {
+		return err
+	}
+
+	return &redactedError{err: err, msg: a.Redact(err.Error())}
+}
+
+// joinEnv adds the patterns to the comma separated list in the environment variable of the builder.
+func joinEnv(name string, patterns []string) string {
+	if v := os.Getenv(name); v != "" {
+		patterns = append([]string{v}, patterns...)
+	}
+
+	return strings.Join(patterns, ",")
+}
+
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redact replaces the secrets, as well as their url encoded form, in s.
+func redact(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+
+		s = strings.ReplaceAll(s, secret, "[REDACTED]")
+		if escaped := url.QueryEscape(secret); escaped != secret {
+			s = strings.ReplaceAll(s, escaped, "[REDACTED]")
+		}
+	}
+
+	return s
+}
+
+// redactingWriter removes secrets from the output a line at a time; Close flushes an unfinished last line.
+type redactingWriter struct {
+	w       io.Writer
+	secrets []string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func newRedactingWriter(w io.Writer, secrets []string) *redactingWriter {
+	return &redactingWriter{w: w, secrets: secrets}
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.buf = append(r.buf, p...)
+	if i := bytes.LastIndexByte(r.buf, '\n'); i >= 0 {
+		lines := redact(string(r.buf[:i+1]), r.secrets)
+		r.buf = append(r.buf[:0], r.buf[i+1:]...)
+		if _, err := io.WriteString(r.w, lines); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+func (r *redactingWriter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.buf) == 0 {
+		return nil
+	}
+
+	rest := redact(string(r.buf), r.secrets)
+	r.buf = nil
+	_, err := io.WriteString(r.w, rest)
+	return err
+}
@@ -3,32 +3,189 @@ package builder
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/rs/xid"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/wombatwisdom/wombat-builder/builder"
 	"github.com/wombatwisdom/wombat-builder/internal/store"
 	"github.com/wombatwisdom/wombat-builder/public/model"
+	"github.com/wombatwisdom/wombat-builder/sbom"
+	"github.com/wombatwisdom/wombat-builder/signing"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
-func NewBuilder(s *store.Store, workers int) (*Builder, error) {
-	return &Builder{
-		Id:    xid.New().String(),
-		s:     s,
-		queue: make(chan buildWithRevision, workers),
-	}, nil
+// heartbeatInterval is the time between two heartbeats of a builder, well below the TTL of the builders bucket.
+const heartbeatInterval = 10 * time.Second
+
+const (
+	claimAttempts   = 3
+	claimRetryDelay = 500 * time.Millisecond
+)
+
+type BuilderOpt func(*Builder)
+
+// WithTimeouts sets the default timeouts of the toolchain phases. Builds can override them individually.
+func WithTimeouts(timeouts Timeouts) BuilderOpt {
+	return func(b *Builder) {
+		b.timeouts = timeouts
+	}
+}
+
+// WithLimits constrains the resources available to the toolchain while building.
+func WithLimits(limits *builder.Limits) BuilderOpt {
+	return func(b *Builder) {
+		b.limits = limits
+	}
+}
+
+// WithSBOMFormats sets the formats of the software bills of materials generated for every artifact.
+func WithSBOMFormats(formats ...sbom.Format) BuilderOpt {
+	return func(b *Builder) {
+		b.sbomFormats = formats
+	}
+}
+
+// WithSigner signs every artifact with the given signer. Without a signer, artifacts only get a SHA-256 digest.
+func WithSigner(signer *signing.Signer) BuilderOpt {
+	return func(b *Builder) {
+		b.signer = signer
+	}
+}
+
+// WithCompression stores every artifact in these encodings as well; none are stored by default.
+func WithCompression(compressions ...Compression) BuilderOpt {
+	return func(b *Builder) {
+		b.compressions = compressions
+	}
+}
+
+// WithBundles stores an archive bundling every artifact with a manifest describing the build.
+func WithBundles(enabled bool) BuilderOpt {
+	return func(b *Builder) {
+		b.bundles = enabled
+	}
+}
+
+// WithCache makes all builds share the given module and build cache, which is pruned at the given interval.
+func WithCache(cache *builder.Cache, pruneInterval time.Duration) BuilderOpt {
+	return func(b *Builder) {
+		b.cache = cache
+		b.pruneInterval = pruneInterval
+	}
+}
+
+// WithSecrets sets where the builder looks up the credentials of private libraries.
+func WithSecrets(secrets *Secrets) BuilderOpt {
+	return func(b *Builder) {
+		b.secrets = secrets
+	}
+}
+
+// WithToolchains sets the go toolchains to build with; without them only the go on the PATH is used.
+func WithToolchains(toolchains *Toolchains) BuilderOpt {
+	return func(b *Builder) {
+		b.toolchains = toolchains
+	}
+}
+
+func NewBuilder(s *store.Store, workers int, opts ...BuilderOpt) (*Builder, error) {
+	b := &Builder{
+		Id:          xid.New().String(),
+		s:           s,
+		sbomFormats: []sbom.Format{sbom.FormatCycloneDX},
+		workers:     workers,
+		sched:       newScheduler(),
+		active:      map[string]struct{}{},
+		retries:     map[string]*pendingRetry{},
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	if b.toolchains == nil {
+		toolchains, err := NewToolchains(context.Background(), "", "", false)
+		if err != nil {
+			return nil, err
+		}
+		b.toolchains = toolchains
+	}
+
+	if err := b.detectCapabilities(context.Background()); err != nil {
+		return nil, err
+	}
+
+	if err := b.limits.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid resource limits: %w", err)
+	}
+
+	for _, c := range b.compressions {
+		if !c.Valid() {
+			return nil, fmt.Errorf("unsupported compression %q", c)
+		}
+	}
+
+	for _, format := range b.sbomFormats {
+		if !format.Valid() {
+			return nil, fmt.Errorf("unsupported sbom format %q", format)
+		}
+	}
+
+	return b, nil
 }
 
 type Builder struct {
 	Id string
 	s  *store.Store
 
-	queue chan buildWithRevision
+	timeouts     Timeouts
+	limits       *builder.Limits
+	sbomFormats  []sbom.Format
+	signer       *signing.Signer
+	compressions []Compression
+	bundles      bool
+	toolchains   *Toolchains
+	capabilities model.BuilderCapabilities
+	secrets      *Secrets
+
+	cache         *builder.Cache
+	pruneInterval time.Duration
+
+	workers int
+	sched   *scheduler
+
+	mu     sync.Mutex
+	active map[string]struct{}
+
+	retryMu sync.Mutex
+	retries map[string]*pendingRetry
+}
+
+// pendingRetry is the timer bringing back a build once its next attempt is due.
+type pendingRetry struct {
+	at    time.Time
+	timer *time.Timer
 }
 
 func (b *Builder) Run(ctx context.Context) error {
+	// -- announce ourselves before claiming anything, otherwise our claims could be reclaimed straight away
+	if err := b.heartbeat(ctx, time.Now()); err != nil {
+		return fmt.Errorf("failed to register builder: %w", err)
+	}
+	go b.keepAlive(ctx)
+	go b.pruneCache(ctx)
+
 	// -- start the workers
-	for i := 0; i < cap(b.queue); i++ {
+	for i := 0; i < b.workers; i++ {
 		go b.worker(ctx, i)
 	}
 
@@ -38,7 +195,7 @@ func (b *Builder) Run(ctx context.Context) error {
 		return fmt.Errorf("failed to watch builds: %w", err)
 	}
 
-	log.Info().Msgf("builder started with %d workers", cap(b.queue))
+	log.Info().Msgf("builder started with %d workers, supporting go %s on %d platforms", b.workers, strings.Join(b.toolchains.Versions(), ", "), len(b.capabilities.Platforms))
 
 	replayDone := false
 	for {
@@ -54,12 +211,9 @@ func (b *Builder) Run(ctx context.Context) error {
 				continue
 			}
 
-			// -- skip updates until the replay is done
-			if !replayDone {
-				continue
-			}
-
 			if update.Operation() == jetstream.KeyValueDelete {
+				b.sched.forget(update.Key())
+				b.cancelRetry(update.Key())
 				continue
 			}
 
@@ -70,75 +224,562 @@ func (b *Builder) Run(ctx context.Context) error {
 				continue
 			}
 
-			if build.Status != model.BuildStatusNew {
+			// -- the builds in progress on any of the builders are what keeps the scheduling fair
+			b.sched.observe(update.Key(), build)
+
+			// -- builds which already have a builder assigned have been claimed by someone else
+			if build.Status != model.BuildStatusNew || build.Builder != "" {
+				b.sched.remove(update.Key())
+				b.cancelRetry(update.Key())
 				continue
 			}
 
-			// -- this is where the race starts. We will update the build state and try to write it. If the
-			// -- write succeeds, we are the first ones to claim the build and we can start building it
-			// -- otherwise, we will ignore the build and let the other builder handle it
-			build.Builder = b.Id
-			rev, err := b.s.Builds.Update(ctx, update.Key(), &build, update.Revision())
-			if err != nil {
-				// TODO: we actually need to check if the error is a conflict error
+			// -- builds we are not capable of are left for the other builders
+			if !b.canBuild(build) {
 				continue
 			}
 
-			// -- if we made it here, we can start the build
-			b.queue <- buildWithRevision{build, rev}
+			// -- builds waiting for a retry are only claimed once their backoff expires. Their timers are also
+			// -- restored from the replay, since nothing else would bring them back otherwise
+			if !build.IsDue(time.Now()) {
+				b.sched.remove(update.Key())
+				b.scheduleRetry(ctx, update.Key(), *build.NextAttemptAt)
+				continue
+			}
+
+			// -- builds found while replaying are offered as well. Since workers only claim a build once they are
+			// -- free, a backlog does not end up claimed by whichever builder starts first
+			b.cancelRetry(update.Key())
+			b.sched.offer(update.Key(), build, update.Revision())
 		}
 	}
 }
 
-func (b *Builder) worker(ctx context.Context, id int) {
-	logger := log.With().Int("worker", id).Logger()
+// tryClaim claims the build, returning false if someone else got there first.
+func (b *Builder) tryClaim(ctx context.Context, key string, build *model.Build, revision uint64) (uint64, bool) {
+	// -- this is where the race starts. We will update the build state and try to write it. If the
+	// -- write succeeds, we are the first ones to claim the build and we can start building it
+	// -- otherwise, we will ignore the build and let the other builder handle it
+	rev, err := b.claim(ctx, key, build, revision)
+	if err != nil {
+		if !errors.Is(err, store.ErrConflict) {
+			log.Error().Err(err).Str("build", key).Msg("failed to claim build")
+		}
+		return 0, false
+	}
 
-	for {
+	return rev, true
+}
+
+// scheduleRetry offers the build to the workers once its next attempt is due, replacing any retry already pending.
+func (b *Builder) scheduleRetry(ctx context.Context, key string, at time.Time) {
+	b.retryMu.Lock()
+	defer b.retryMu.Unlock()
+
+	if r, fnd := b.retries[key]; fnd {
+		if r.at.Equal(at) {
+			return
+		}
+		r.timer.Stop()
+	}
+
+	r := &pendingRetry{at: at}
+	b.retries[key] = r
+	r.timer = time.AfterFunc(time.Until(at), func() {
+		b.retryMu.Lock()
+		if b.retries[key] == r {
+			delete(b.retries, key)
+		}
+		b.retryMu.Unlock()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		build, rev, err := b.s.Builds.GetWithRevision(ctx, key)
+		if err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				log.Error().Err(err).Str("build", key).Msg("failed to get build for retry")
+			}
+			return
+		}
+
+		if build.Status != model.BuildStatusNew || build.Builder != "" || !build.IsDue(time.Now()) {
+			return
+		}
+
+		b.sched.offer(key, *build, rev)
+	})
+}
+
+// cancelRetry stops the pending retry of the build, if any.
+func (b *Builder) cancelRetry(key string) {
+	b.retryMu.Lock()
+	defer b.retryMu.Unlock()
+
+	if r, fnd := b.retries[key]; fnd {
+		r.timer.Stop()
+		delete(b.retries, key)
+	}
+}
+
+// claim tries to mark the build as ours, returning store.ErrConflict when another builder won the race.
+func (b *Builder) claim(ctx context.Context, key string, build *model.Build, revision uint64) (uint64, error) {
+	build.Builder = b.Id
+
+	for attempt := 1; ; attempt++ {
+		rev, err := b.s.Builds.Update(ctx, key, build, revision)
+		if err == nil {
+			return rev, nil
+		}
+
+		// -- a conflict after a failed attempt may very well be caused by our own write which made it after all
+		if errors.Is(err, store.ErrConflict) && attempt > 1 {
+			current, rev, gerr := b.s.Builds.GetWithRevision(ctx, key)
+			if gerr == nil && current.Builder == b.Id && current.Status == model.BuildStatusNew {
+				return rev, nil
+			}
+		}
+
+		if !errors.Is(err, store.ErrBackbone) || attempt == claimAttempts {
+			return 0, err
+		}
+
+		log.Warn().Err(err).Str("build", key).Msgf("failed to claim build, retrying (attempt %d/%d)", attempt, claimAttempts)
 		select {
 		case <-ctx.Done():
-			return
-		case build := <-b.queue:
-			logger.Debug().Str("build", build.Id()).Msg("starting build")
+			return 0, ctx.Err()
+		case <-time.After(time.Duration(attempt) * claimRetryDelay):
+		}
+	}
+}
+
+// pruneCache keeps the cache within its maximum size, skipping a prune while builds are using the cache.
+func (b *Builder) pruneCache(ctx context.Context) {
+	if b.cache == nil || b.pruneInterval <= 0 || (b.cache.MaxModSize <= 0 && b.cache.MaxBuildSize <= 0) {
+		return
+	}
 
-			// -- update the build status to pending
-			build.Status = model.BuildStatusBuilding
+	ticker := time.NewTicker(b.pruneInterval)
+	defer ticker.Stop()
 
-			rev, err := b.s.Builds.Update(ctx, build.Id(), &build.Build, build.revision)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := b.cache.TryPrune()
+			if errors.Is(err, builder.ErrCacheBusy) {
+				log.Debug().Msg("skipped pruning the cache while builds are using it")
+				continue
+			}
 			if err != nil {
-				logger.Error().Err(err).Msg("failed to start build")
+				log.Error().Err(err).Msg("failed to prune cache")
 				continue
 			}
 
-			// -- start the build
-			task := &BuildTask{Build: &build.Build}
-			artifactPath, err := task.Run(ctx)
-			if err == nil {
-				// -- upload the artifact to the object store
-				oi, err := b.s.Artifacts.WriteFile(ctx, build.Id(), artifactPath)
-				if err == nil {
-					build.Artifact = model.ArtifactReference(oi.Name)
-					build.Builder = ""
-					build.Status = model.BuildStatusSuccess
-				} else {
-					build.Status = model.BuildStatusFailed
-					build.Builder = ""
-					build.Error = err.Error()
-				}
-			} else {
-				build.Status = model.BuildStatusFailed
-				build.Builder = ""
-				build.Error = err.Error()
+			if report.ModEvicted > 0 || report.BuildEvicted > 0 {
+				log.Info().Msgf("pruned %d modules (%d bytes) and %d build cache entries (%d bytes)", report.ModEvicted, report.ModFreed, report.BuildEvicted, report.BuildFreed)
 			}
+		}
+	}
+}
 
-			// -- update the build
-			_, err = b.s.Builds.Update(ctx, build.Id(), &build.Build, rev)
-			if err != nil {
-				logger.Error().Err(err).Msg("failed to update build")
+// keepAlive refreshes the lease of the builder until the context is done, after which the lease is removed.
+func (b *Builder) keepAlive(ctx context.Context) {
+	startedAt := time.Now()
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := b.s.Builders.Remove(context.Background(), b.Id); err != nil {
+				log.Warn().Err(err).Msg("failed to remove builder lease")
+			}
+			return
+		case <-ticker.C:
+			if err := b.heartbeat(ctx, startedAt); err != nil {
+				log.Error().Err(err).Msg("failed to send heartbeat")
 			}
 		}
 	}
 }
 
+func (b *Builder) heartbeat(ctx context.Context, startedAt time.Time) error {
+	b.mu.Lock()
+	builds := make([]string, 0, len(b.active))
+	for id := range b.active {
+		builds = append(builds, id)
+	}
+	b.mu.Unlock()
+	sort.Strings(builds)
+
+	return b.s.Builders.Heartbeat(ctx, &model.BuilderLease{
+		Id:           b.Id,
+		Workers:      b.workers,
+		Builds:       builds,
+		StartedAt:    startedAt,
+		LastSeen:     time.Now(),
+		Capabilities: b.currentCapabilities(),
+	})
+}
+
+func (b *Builder) setActive(id string, active bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if active {
+		b.active[id] = struct{}{}
+	} else {
+		delete(b.active, id)
+	}
+}
+
+func (b *Builder) worker(ctx context.Context, id int) {
+	logger := log.With().Int("worker", id).Logger()
+
+	// -- a build is only claimed once the worker is free to start it, so no builder holds on to builds it can not
+	// -- start yet while others are idle
+	for {
+		c, ok := b.sched.next(ctx)
+		if !ok {
+			return
+		}
+
+		rev, ok := b.tryClaim(ctx, c.key, &c.build, c.revision)
+		b.sched.claimed(c.key)
+		if !ok {
+			continue
+		}
+
+		b.process(ctx, logger, buildWithRevision{c.build, rev})
+	}
+}
+
+func (b *Builder) process(ctx context.Context, logger zerolog.Logger, build buildWithRevision) {
+	logger = logger.With().Str("build", build.Id()).Logger()
+	logger.Debug().Msg("starting build")
+
+	b.setActive(build.Id(), true)
+	defer b.setActive(build.Id(), false)
+
+	// -- watch the build before marking it as building, so a cancellation can never slip through in between
+	buildCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err := b.watchForCancellation(buildCtx, cancel, build.Id()); err != nil {
+		logger.Error().Err(err).Msg("failed to watch build")
+		return
+	}
+
+	// -- update the build status to pending
+	build.Status = model.BuildStatusBuilding
+	build.Attempts++
+	build.NextAttemptAt = nil
+	build.Phases = nil
+	build.Modules = nil
+	build.SBOM = nil
+	build.Variants = nil
+
+	rev, err := b.s.Builds.Update(ctx, build.Id(), &build.Build, build.revision)
+	if err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			logger.Info().Msg("build changed after it was claimed, not starting it")
+		} else {
+			logger.Error().Err(err).Msg("failed to start build")
+		}
+		return
+	}
+
+	// -- capture the toolchain output in the build log, while still showing it on the builder itself. The tail of
+	// -- the output is kept to decide whether a failed build is worth retrying
+	tail := newTailBuffer(outputTailSize)
+	output := io.MultiWriter(os.Stdout, tail)
+	lw, err := b.s.Logs.Writer(ctx, build.Id())
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to open build log, continuing without it")
+	} else {
+		output = io.MultiWriter(output, lw)
+	}
+
+	// -- the credentials of private modules only live for the duration of the build, and never make it into the
+	// -- output or the error of the build
+	access, accessErr := prepareAccess(build.Access, b.secrets)
+	if accessErr != nil {
+		access = &moduleAccess{}
+	}
+	defer access.Close()
+	redactor := newRedactingWriter(output, access.Secrets)
+
+	// -- every phase change is written to the store, so clients can follow the progress of the build. Failing to do
+	// -- so is not a reason to stop the build; if the build changed underneath us, the watcher will abort it anyway
+	progress := func() {
+		var err error
+		if rev, err = b.record(ctx, &build.Build, rev); err != nil {
+			logger.Warn().Err(err).Msg("failed to record build progress")
+		}
+	}
+
+	// -- start the build
+	task := &BuildTask{
+		Build:       &build.Build,
+		Output:      redactor,
+		Env:         access.Env,
+		Timeouts:    b.timeouts.Override(build.Timeouts),
+		Limits:      b.limits,
+		Toolchains:  b.toolchains,
+		Cache:       b.cache,
+		CgoCompiler: b.capabilities.CgoCompilers[model.Platform{Goos: build.Goos, Goarch: build.Goarch}.String()],
+		Progress:    progress,
+	}
+	var out *BuildOutput
+	if accessErr != nil {
+		err = fmt.Errorf("failed to prepare access to private modules: %w", accessErr)
+	} else {
+		out, err = task.Run(buildCtx)
+		_ = redactor.Close()
+		err = access.RedactError(err)
+	}
+	if err == nil {
+		// -- upload the artifact to the object store, together with the modules it was built from
+		build.StartPhase(model.PhaseUpload, time.Now())
+		progress()
+
+		var oi *jetstream.ObjectInfo
+		oi, err = b.s.Artifacts.WriteFile(buildCtx, build.Id(), out.Executable, store.WithCompanions(b.signer))
+		if err == nil {
+			build.Artifact = model.ArtifactReference(oi.Name)
+			build.Modules, err = b.uploadModules(buildCtx, build.Id(), out)
+		}
+		if err == nil {
+			build.SBOM, err = b.uploadSBOMs(buildCtx, build.Id(), out)
+		}
+		if err == nil {
+			build.Variants, err = b.uploadVariants(buildCtx, &build.Build, out)
+		}
+		build.EndPhase(model.PhaseUpload, time.Now(), phaseOutcome(buildCtx, err))
+	}
+
+	build.Builder = ""
+	build.FailureReason = ""
+	retryable := err != nil && isRetryable(err, tail.String())
+	if err == nil {
+		build.Status = model.BuildStatusSuccess
+		build.Error = ""
+	} else if retryable && build.CanRetry() {
+		// -- handing the build back as new makes every builder schedule the next attempt
+		next := time.Now().Add(retryDelay(build.Attempts))
+		build.Status = model.BuildStatusNew
+		build.NextAttemptAt = &next
+		build.Error = err.Error()
+		logger.Warn().Err(err).Msgf("build failed, retrying at %s (attempt %d/%d)", next.Format(time.RFC3339), build.Attempts, build.MaxAttempts)
+	} else {
+		build.Status = model.BuildStatusFailed
+		build.Error = err.Error()
+		build.FailureReason = failureReason(err, retryable)
+	}
+
+	// -- mark the end of the log before recording the outcome, so anyone seeing the final status has the full log
+	if lw != nil {
+		_ = lw.Close()
+	}
+
+	// -- the build was cancelled or reclaimed while we were working on it. The build has already been updated by
+	// -- whoever did that, so there is nothing left for us to record
+	if buildCtx.Err() != nil && ctx.Err() == nil {
+		logger.Info().Msg("build cancelled or reclaimed")
+		return
+	}
+
+	// -- update the build
+	_, err = b.record(ctx, &build.Build, rev)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to update build")
+	}
+}
+
+// record writes the state of a build we are working on, retrying with the latest revision while the build is ours.
+func (b *Builder) record(ctx context.Context, build *model.Build, rev uint64) (uint64, error) {
+	for attempt := 1; ; attempt++ {
+		nrev, err := b.s.Builds.Update(ctx, build.Id(), build, rev)
+		if err == nil {
+			return nrev, nil
+		}
+
+		if !(errors.Is(err, store.ErrConflict) || errors.Is(err, store.ErrBackbone)) || attempt == claimAttempts {
+			return rev, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return rev, ctx.Err()
+		case <-time.After(time.Duration(attempt) * claimRetryDelay):
+		}
+
+		current, crev, gerr := b.s.Builds.GetWithRevision(ctx, build.Id())
+		if gerr != nil {
+			continue
+		}
+
+		// -- the build was cancelled or reclaimed in the meantime, so whatever we have to say no longer matters
+		if current.Builder != b.Id || current.Status != model.BuildStatusBuilding || current.Attempts != build.Attempts {
+			return rev, fmt.Errorf("build is no longer ours: %w", err)
+		}
+		rev = crev
+	}
+}
+
+// uploadModules stores the module files of the build next to its artifact.
+func (b *Builder) uploadModules(ctx context.Context, id string, out *BuildOutput) (*model.ModuleReferences, error) {
+	files := map[string]*model.ArtifactReference{}
+	refs := &model.ModuleReferences{}
+
+	files[out.GoMod] = &refs.GoMod
+	files[out.ModuleList] = &refs.List
+	if out.GoSum != "" {
+		files[out.GoSum] = &refs.GoSum
+	}
+
+	if err := b.uploadFiles(ctx, id, files); err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// uploadSBOMs generates the bills of materials of the build and stores them next to its artifact.
+func (b *Builder) uploadSBOMs(ctx context.Context, id string, out *BuildOutput) (*model.SBOMReferences, error) {
+	generated, err := generateSBOMs(id, out, b.sbomFormats)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]*model.ArtifactReference{}
+	refs := &model.SBOMReferences{}
+	for format, file := range generated {
+		switch format {
+		case sbom.FormatCycloneDX:
+			files[file] = &refs.CycloneDX
+		case sbom.FormatSPDX:
+			files[file] = &refs.SPDX
+		}
+	}
+
+	if err := b.uploadFiles(ctx, id, files); err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// uploadVariants stores the compressed copies and the archive of the artifact next to it, when enabled.
+func (b *Builder) uploadVariants(ctx context.Context, build *model.Build, out *BuildOutput) (*model.ArtifactVariants, error) {
+	if len(b.compressions) == 0 && !b.bundles {
+		return nil, nil
+	}
+
+	id := build.Id()
+	refs := &model.ArtifactVariants{}
+
+	for _, c := range b.compressions {
+		file, err := compress(out, c)
+		if err != nil {
+			return nil, err
+		}
+
+		ref, suffix := &refs.Zstd, store.ZstdSuffix
+		if c == CompressionGzip {
+			ref, suffix = &refs.Gzip, store.GzipSuffix
+		}
+
+		oi, err := b.s.Artifacts.WriteFile(ctx, id+suffix, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload %s artifact: %w", c, err)
+		}
+		*ref = model.ArtifactReference(oi.Name)
+	}
+
+	if !b.bundles {
+		return refs, nil
+	}
+
+	file, err := bundle(id, build, out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bundle artifact: %w", err)
+	}
+
+	suffix := store.TarGzSuffix
+	if build.Goos == "windows" {
+		suffix = store.ZipSuffix
+	}
+
+	oi, err := b.s.Artifacts.WriteFile(ctx, id+suffix, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload bundle: %w", err)
+	}
+	refs.Bundle = model.ArtifactReference(oi.Name)
+
+	return refs, nil
+}
+
+// uploadFiles stores each of the files as <build id>.<file name>, recording the name it was stored under.
+func (b *Builder) uploadFiles(ctx context.Context, id string, files map[string]*model.ArtifactReference) error {
+	for file, ref := range files {
+		oi, err := b.s.Artifacts.WriteFile(ctx, fmt.Sprintf("%s.%s", id, path.Base(file)), file)
+		if err != nil {
+			return fmt.Errorf("failed to upload %s: %w", path.Base(file), err)
+		}
+		*ref = model.ArtifactReference(oi.Name)
+	}
+
+	return nil
+}
+
+// watchForCancellation calls cancel once the build is cancelled, reclaimed by someone else or removed.
+func (b *Builder) watchForCancellation(ctx context.Context, cancel context.CancelFunc, key string) error {
+	kw, err := b.s.Builds.WatchKey(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer kw.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case update, ok := <-kw.Updates():
+				if !ok {
+					return
+				}
+
+				if update == nil {
+					continue
+				}
+
+				if update.Operation() != jetstream.KeyValuePut {
+					cancel()
+					return
+				}
+
+				var build model.Build
+				if err := json.Unmarshal(update.Value(), &build); err != nil {
+					log.Error().Err(err).Msg("failed to unmarshal build")
+					continue
+				}
+
+				if build.Status == model.BuildStatusCancelled || build.Builder != b.Id {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
 type buildWithRevision struct {
 	model.Build
 	revision uint64
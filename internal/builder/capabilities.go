@@ -0,0 +1,89 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"os/exec"
+	"runtime"
+	"slices"
+)
+
+// pluginHosts are the operating systems on which the go toolchain supports the plugin build mode.
+var pluginHosts = []string{"linux", "darwin", "freebsd"}
+
+// hostCompilers are the C compilers looked for on the PATH to do cgo builds for the host platform.
+var hostCompilers = []string{"cc", "gcc", "clang"}
+
+// WithPlatforms restricts the platforms built for, which default to all the go on the PATH supports.
+func WithPlatforms(platforms ...model.Platform) BuilderOpt {
+	return func(b *Builder) {
+		b.capabilities.Platforms = platforms
+	}
+}
+
+// WithCgoCompilers sets the C compiler for cgo builds by goos/goarch, defaulting to the one on the PATH.
+func WithCgoCompilers(compilers map[string]string) BuilderOpt {
+	return func(b *Builder) {
+		b.capabilities.CgoCompilers = compilers
+	}
+}
+
+// detectCapabilities completes the capabilities of the builder with what it finds on the machine.
+func (b *Builder) detectCapabilities(ctx context.Context) error {
+	caps := &b.capabilities
+	caps.Host = model.Platform{Goos: runtime.GOOS, Goarch: runtime.GOARCH}
+
+	if len(caps.Platforms) == 0 {
+		caps.Platforms = []model.Platform{caps.Host}
+
+		if tc := b.toolchains.System(); tc != nil {
+			platforms, err := tc.Command("").GoToolDistList(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to list the platforms supported by go: %w", err)
+			}
+
+			caps.Platforms = caps.Platforms[:0]
+			for _, p := range platforms {
+				platform, err := model.ParsePlatform(p)
+				if err != nil {
+					return err
+				}
+				caps.Platforms = append(caps.Platforms, platform)
+			}
+		}
+	}
+
+	if caps.CgoCompilers == nil {
+		caps.CgoCompilers = map[string]string{}
+	}
+
+	if _, fnd := caps.CgoCompilers[caps.Host.String()]; !fnd {
+		for _, cc := range hostCompilers {
+			if p, err := exec.LookPath(cc); err == nil {
+				caps.CgoCompilers[caps.Host.String()] = p
+				break
+			}
+		}
+	}
+
+	// -- plugins are always built with cgo, and only for the platform the builder runs on
+	caps.Plugin = slices.Contains(pluginHosts, caps.Host.Goos) && caps.CgoCompilers[caps.Host.String()] != ""
+
+	return nil
+}
+
+// currentCapabilities returns the capability document of the builder, including the go versions it currently has.
+func (b *Builder) currentCapabilities() model.BuilderCapabilities {
+	caps := b.capabilities
+	caps.GoVersions = b.toolchains.Versions()
+	caps.ToolchainDownload = b.toolchains.Download()
+
+	return caps
+}
+
+// canBuild tells whether the builder is capable of building the build.
+func (b *Builder) canBuild(build model.Build) bool {
+	target := model.Platform{Goos: build.Goos, Goarch: build.Goarch}
+	return b.capabilities.Accepts(target, build.Constraints) && b.toolchains.Supports(build.GoVersion)
+}
@@ -0,0 +1,126 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// retryBaseDelay is the delay before the first retry of a failed build, doubling up to retryMaxDelay.
+	retryBaseDelay = 30 * time.Second
+	retryMaxDelay  = 15 * time.Minute
+
+	// outputTailSize is the amount of toolchain output kept around to figure out why a build failed.
+	outputTailSize = 64 * 1024
+)
+
+// transientFailures are fragments of toolchain output blaming the network or the module proxy for a failure.
+var transientFailures = []string{
+	"dial tcp",
+	"i/o timeout",
+	"tls handshake timeout",
+	"connection reset by peer",
+	"connection refused",
+	"no such host",
+	"temporary failure in name resolution",
+	"unexpected eof",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+	"429 too many requests",
+}
+
+// isRetryable decides whether a failed build is worth another attempt, like after a network problem or a store failure.
+func isRetryable(err error, output string) bool {
+	// -- compiling takes as long the next time, so running it again would only waste the builder
+	var te *TimeoutError
+	if errors.As(err, &te) {
+		return te.Phase != goBuildPhase
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, store.ErrBackbone) {
+		return true
+	}
+
+	output = strings.ToLower(output)
+	for _, fragment := range transientFailures {
+		if strings.Contains(output, fragment) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// failureReason tells why a build which will not be retried anymore failed.
+func failureReason(err error, retryable bool) model.FailureReason {
+	var te *TimeoutError
+	switch {
+	case errors.As(err, &te):
+		return model.FailureReasonTimeout
+	case retryable:
+		return model.FailureReasonTransient
+	default:
+		return model.FailureReasonBuild
+	}
+}
+
+// phaseOutcome translates the result of a phase into its outcome.
+func phaseOutcome(ctx context.Context, err error) model.PhaseOutcome {
+	var te *TimeoutError
+	switch {
+	case err == nil:
+		return model.PhaseOutcomeSuccess
+	case errors.As(err, &te):
+		return model.PhaseOutcomeTimeout
+	case ctx.Err() != nil:
+		return model.PhaseOutcomeCancelled
+	default:
+		return model.PhaseOutcomeFailed
+	}
+}
+
+// retryDelay returns the time to wait before the next attempt, given the number of attempts made so far.
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, retryMaxDelay)
+}
+
+// tailBuffer keeps the last bytes written to it.
+type tailBuffer struct {
+	mu   sync.Mutex
+	size int
+	buf  []byte
+}
+
+func newTailBuffer(size int) *tailBuffer {
+	return &tailBuffer{size: size}
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.size {
+		t.buf = t.buf[len(t.buf)-t.size:]
+	}
+
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return string(t.buf)
+}
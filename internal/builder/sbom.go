@@ -0,0 +1,48 @@
+package builder
+
+import (
+	"fmt"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"github.com/wombatwisdom/wombat-builder/sbom"
+	"os"
+	"path"
+)
+
+// generateSBOMs writes a bill of materials in each of the formats next to the executable.
+func generateSBOMs(id string, out *BuildOutput, formats []sbom.Format) (map[sbom.Format]string, error) {
+	in, err := sbom.ReadInput(out.Executable, "github.com/wombatwisdom/wombat", id)
+	if err != nil {
+		return nil, err
+	}
+
+	modules, err := os.ReadFile(out.ModuleList)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read module list: %w", err)
+	}
+	in.Modules = model.ParseModuleList(modules)
+
+	result := map[sbom.Format]string{}
+	for _, format := range formats {
+		file := path.Join(path.Dir(out.Executable), fmt.Sprintf("sbom.%s", format.Extension()))
+		if err := writeSBOM(file, format, in); err != nil {
+			return nil, fmt.Errorf("failed to generate %s sbom: %w", format, err)
+		}
+		result[format] = file
+	}
+
+	return result, nil
+}
+
+func writeSBOM(file string, format sbom.Format, in *sbom.Input) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := sbom.Write(f, format, in); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,176 @@
+package builder
+
+import (
+	"context"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"sync"
+)
+
+// candidate is a build waiting to be claimed.
+type candidate struct {
+	key      string
+	build    model.Build
+	revision uint64
+
+	// arrival orders candidates of the same priority and requester, oldest first.
+	arrival uint64
+}
+
+// scheduler hands out builds by priority, then to the requester with the fewest builds in progress, then by age.
+type scheduler struct {
+	mu sync.Mutex
+
+	pending map[string]*candidate
+	arrival uint64
+
+	// busy holds the requester of every build in progress, claiming the builds our workers are still claiming.
+	busy     map[string]string
+	claiming map[string]string
+
+	// served holds when each requester was last handed a build, as a sequence number.
+	served map[string]uint64
+	seq    uint64
+
+	notify chan struct{}
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{
+		pending:  map[string]*candidate{},
+		busy:     map[string]string{},
+		claiming: map[string]string{},
+		served:   map[string]uint64{},
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+// observe keeps track of the builds in progress, based on the latest known state of the build.
+func (s *scheduler) observe(key string, build model.Build) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if build.Builder != "" && !build.Status.IsTerminal() {
+		s.busy[key] = build.Requester
+	} else {
+		delete(s.busy, key)
+	}
+}
+
+// offer makes the build available for claiming, replacing an earlier offer of the same build.
+func (s *scheduler) offer(key string, build model.Build, revision uint64) {
+	s.mu.Lock()
+	if c, fnd := s.pending[key]; fnd {
+		c.build, c.revision = build, revision
+	} else {
+		s.arrival++
+		s.pending[key] = &candidate{key: key, build: build, revision: revision, arrival: s.arrival}
+	}
+	s.mu.Unlock()
+
+	s.wake()
+}
+
+// remove withdraws the build, if it was offered.
+func (s *scheduler) remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pending, key)
+}
+
+// forget drops everything known about a build which was removed from the store.
+func (s *scheduler) forget(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pending, key)
+	delete(s.busy, key)
+}
+
+// claimed tells the scheduler the worker is done claiming a build handed out by next, successful or not.
+func (s *scheduler) claimed(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.claiming, key)
+}
+
+// next waits for a build and hands it out, counting it as in progress until claimed is called.
+func (s *scheduler) next(ctx context.Context) (candidate, bool) {
+	for {
+		s.mu.Lock()
+		c := s.pick()
+		if c != nil {
+			delete(s.pending, c.key)
+			s.claiming[c.key] = c.build.Requester
+			s.seq++
+			s.served[c.build.Requester] = s.seq
+		}
+		more := len(s.pending) > 0
+		s.mu.Unlock()
+
+		// -- offers are coalesced into a single notification, so pass it on to the next idle worker
+		if more {
+			s.wake()
+		}
+
+		if c != nil {
+			return *c, true
+		}
+
+		select {
+		case <-ctx.Done():
+			return candidate{}, false
+		case <-s.notify:
+		}
+	}
+}
+
+// pick returns the candidate to hand out next, or nil if there is none.
+func (s *scheduler) pick() *candidate {
+	load := map[string]int{}
+	for key, requester := range s.busy {
+		if _, fnd := s.claiming[key]; !fnd {
+			load[requester]++
+		}
+	}
+	for _, requester := range s.claiming {
+		load[requester]++
+	}
+
+	var best *candidate
+	for _, c := range s.pending {
+		if best == nil || s.before(c, best, load) {
+			best = c
+		}
+	}
+
+	return best
+}
+
+// before tells whether candidate a goes before candidate b.
+func (s *scheduler) before(a *candidate, b *candidate, load map[string]int) bool {
+	if a.build.Priority != b.build.Priority {
+		return a.build.Priority > b.build.Priority
+	}
+
+	ra, rb := a.build.Requester, b.build.Requester
+	if ra != rb {
+		if load[ra] != load[rb] {
+			return load[ra] < load[rb]
+		}
+
+		if s.served[ra] != s.served[rb] {
+			return s.served[ra] < s.served[rb]
+		}
+	}
+
+	return a.arrival < b.arrival
+}
+
+func (s *scheduler) wake() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
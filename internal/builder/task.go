@@ -8,18 +8,69 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/wombatwisdom/wombat-builder/builder"
 	"github.com/wombatwisdom/wombat-builder/public/model"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
+	"strings"
 	"text/template"
+	"time"
 )
 
+//go:embed templates/go.mod.template
+var goModTemplate string
+
+//go:embed templates/main.go.template
+var mainGoTemplate string
+
+var templates = map[string]string{
+	"main.go": mainGoTemplate,
+	"go.mod":  goModTemplate,
+}
+
 type BuildTask struct {
 	*model.Build
+
+	// Output receives the output of the go toolchain. When not set, the output is written to stdout.
+	Output io.Writer
+
+	// Timeouts limits the duration of the toolchain phases.
+	Timeouts Timeouts
+
+	// Limits constrains the resources of the toolchain commands. Nil means no limits.
+	Limits *builder.Limits
+
+	// Toolchains provides the go toolchain matching the go version of the build.
+	Toolchains *Toolchains
+
+	// CgoCompiler is the C compiler for the target platform, used when the build requires cgo.
+	CgoCompiler string
+
+	// Cache is shared between builds, without it the default caches of the user are used.
+	Cache *builder.Cache
+
+	// Env holds additional environment variables for the toolchain, like the settings to reach private modules.
+	Env []string
+
+	// Progress is called every time a phase of the build started or ended.
+	Progress func()
 }
 
-func (t *BuildTask) Run(ctx context.Context) (string, error) {
+// BuildOutput holds the paths of the files produced by a build task.
+type BuildOutput struct {
+	// Executable is the wombat binary.
+	Executable string
+
+	// GoMod and GoSum are the module files as resolved by the toolchain.
+	GoMod string
+	GoSum string
+
+	// ModuleList holds the output of go list -m all.
+	ModuleList string
+}
+
+func (t *BuildTask) Run(ctx context.Context) (*BuildOutput, error) {
 	logger := log.With().Str("build", t.Id()).Logger()
 	defer func() {
 		logger.Info().Msg("build finished")
@@ -33,26 +84,190 @@ func (t *BuildTask) Run(ctx context.Context) (string, error) {
 	logger.Debug().Msg("creating temp dir")
 	dir := path.Join(os.TempDir(), "wombat-builder", t.Id())
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create temp dir: %w", err)
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
 	}
 
-	logger.Info().Msgf("building in %s", dir)
-	if err := t.generate(dir, &logger); err != nil {
-		return "", fmt.Errorf("failed to generate module files: %w", err)
+	// -- fetching a toolchain through GOTOOLCHAIN downloads it, so it falls under the timeout of fetching modules
+	var tc *Toolchain
+	err := withTimeout(ctx, "go version", t.Timeouts.Get, func(ctx context.Context) error {
+		var err error
+		tc, err = t.Toolchains.Resolve(ctx, t.GoVersion)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to select toolchain: %w", err)
+	}
+
+	logger.Info().Msgf("building in %s with go %s", dir, tc.Version)
+	err = t.phase(ctx, model.PhaseGenerate, func(ctx context.Context) error {
+		return t.generate(dir, &logger)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate module files: %w", err)
+	}
+
+	c := tc.Command(dir).WithLimits(t.Limits)
+	if t.Cache != nil {
+		release, err := t.Cache.Use()
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		c = c.WithEnv(t.Cache.Env()...)
+	}
+	if t.Constraints != nil && (t.Constraints.Cgo || t.Constraints.Plugin) {
+		c = c.WithEnv("CGO_ENABLED=1", fmt.Sprintf("CC=%s", t.CgoCompiler))
+	}
+	if len(t.Env) > 0 {
+		c = c.WithEnv(t.Env...)
+	}
+	if t.Output != nil {
+		c = c.WithOutput(t.Output)
+	}
+	c = c.WithLdflags(t.ldflags(time.Now())...)
+	// -- fetch the pinned modules first, so tidy does not resolve them to their latest version
+	reqs := t.Requirements()
+	if len(reqs) > 0 {
+		logger.Info().Msg("fetching pinned modules")
+		err = t.phase(ctx, model.PhaseGet, func(ctx context.Context) error {
+			for _, req := range reqs {
+				err := withTimeout(ctx, "go get", t.Timeouts.Get, func(ctx context.Context) error {
+					return c.GoGet(ctx, fmt.Sprintf("%s@%s", req.Module, req.Version))
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pinned modules: %w", err)
+		}
 	}
 
-	c := builder.InDir(dir)
 	logger.Info().Msg("pulling in module imports")
-	if err := c.GoModTidy(ctx); err != nil {
-		return "", fmt.Errorf("failed to tidy go modules: %w", err)
+	err = t.phase(ctx, model.PhaseTidy, func(ctx context.Context) error {
+		return withTimeout(ctx, "go mod tidy", t.Timeouts.Tidy, func(ctx context.Context) error {
+			if err := c.GoModTidy(ctx); err != nil {
+				return err
+			}
+
+			// -- minimal version selection raises a pin when another module requires a newer version of it
+			if len(reqs) == 0 {
+				return nil
+			}
+
+			modules, err := c.GoListModules(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to list modules: %w", err)
+			}
+
+			return checkPins(model.ParseModuleList(modules), reqs)
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to tidy go modules: %w", err)
 	}
 
 	logger.Info().Msg("building wombat")
-	if err := c.GoBuild(ctx); err != nil {
-		return "", fmt.Errorf("failed to build wombat: %w", err)
+	out := &BuildOutput{
+		Executable: path.Join(dir, "wombat"),
+		GoMod:      path.Join(dir, "go.mod"),
+		ModuleList: path.Join(dir, "modules.txt"),
+	}
+	err = t.phase(ctx, model.PhaseBuild, func(ctx context.Context) error {
+		return withTimeout(ctx, goBuildPhase, t.Timeouts.Build, func(ctx context.Context) error {
+			build := c.GoBuildExecutable
+			if t.Constraints != nil && t.Constraints.Plugin {
+				build = c.GoBuild
+			}
+
+			if err := build(ctx, t.Goos, t.Goarch, out.Executable); err != nil {
+				return err
+			}
+
+			// -- record the module graph the executable was built from
+			modules, err := c.GoListModules(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to list modules: %w", err)
+			}
+
+			return os.WriteFile(out.ModuleList, modules, 0644)
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build wombat: %w", err)
+	}
+
+	if _, err := os.Stat(path.Join(dir, "go.sum")); err == nil {
+		out.GoSum = path.Join(dir, "go.sum")
+	}
+
+	return out, nil
+}
+
+// checkPins makes sure the modules resolved to the versions they were pinned to.
+func checkPins(modules []model.Module, reqs []model.Requirement) error {
+	resolved := map[string]string{}
+	for _, m := range modules {
+		resolved[m.Path] = m.Version
+	}
+
+	var mismatches []string
+	for _, req := range reqs {
+		if v, fnd := resolved[req.Module]; fnd && v != req.Version {
+			mismatches = append(mismatches, fmt.Sprintf("%s is pinned to %s but resolved to %s", req.Module, req.Version, v))
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("pinned modules were raised by other requirements: %s", strings.Join(mismatches, ", "))
+	}
+
+	return nil
+}
+
+// phase runs fn as the named phase of the build, recording when it started and ended and how it went.
+func (t *BuildTask) phase(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	t.StartPhase(name, time.Now())
+	t.progress()
+
+	err := fn(ctx)
+
+	t.EndPhase(name, time.Now(), phaseOutcome(ctx, err))
+	t.progress()
+	return err
+}
+
+func (t *BuildTask) progress() {
+	if t.Progress != nil {
+		t.Progress()
+	}
+}
+
+// DistributionName is the name the binary presents itself with.
+func (t *BuildTask) DistributionName() string {
+	if t.Distribution == nil {
+		return model.DefaultDistributionName
+	}
+
+	return t.Distribution.Name
+}
+
+// ldflags stamps the version, the build id and the time of building into the main package.
+func (t *BuildTask) ldflags(now time.Time) []string {
+	flags := []string{
+		fmt.Sprintf("-X main.buildID=%s", t.Id()),
+		fmt.Sprintf("-X main.dateBuilt=%s", now.UTC().Format(time.RFC3339)),
+	}
+
+	if t.Distribution != nil && t.Distribution.Version != "" {
+		flags = append(flags, fmt.Sprintf("-X main.version=%s", t.Distribution.Version))
 	}
 
-	return path.Join(dir, "wombat"), nil
+	return flags
 }
 
 func (t *BuildTask) generate(dir string, logger *zerolog.Logger) error {
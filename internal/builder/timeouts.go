@@ -0,0 +1,68 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"time"
+)
+
+// Timeouts holds the maximum duration of each toolchain phase of a build, zero disables the timeout.
+type Timeouts struct {
+	Get   time.Duration
+	Tidy  time.Duration
+	Build time.Duration
+}
+
+// Override returns the timeouts with the non-zero values of the build specific overrides applied.
+func (t Timeouts) Override(o *model.PhaseTimeouts) Timeouts {
+	if o == nil {
+		return t
+	}
+
+	if o.Get > 0 {
+		t.Get = time.Duration(o.Get)
+	}
+	if o.Tidy > 0 {
+		t.Tidy = time.Duration(o.Tidy)
+	}
+	if o.Build > 0 {
+		t.Build = time.Duration(o.Build)
+	}
+
+	return t
+}
+
+// goBuildPhase is the toolchain phase compiling the binary.
+const goBuildPhase = "go build"
+
+// TimeoutError is returned when a toolchain phase did not finish in time.
+type TimeoutError struct {
+	Phase   string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s did not finish within %s", e.Phase, e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// withTimeout runs fn with a deadline, reporting a toolchain killed by that deadline as a TimeoutError.
+func withTimeout(ctx context.Context, phase string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := fn(ctx)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return &TimeoutError{Phase: phase, Timeout: timeout}
+	}
+
+	return err
+}
@@ -0,0 +1,401 @@
+package builder
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"github.com/wombatwisdom/wombat-builder/builder"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// minSwitchableVersion is the first go release able to fetch other toolchains through GOTOOLCHAIN.
+const minSwitchableVersion = "1.21.0"
+
+// Toolchain is a go toolchain a build can run with.
+type Toolchain struct {
+	// Version is the version of the toolchain, without the go prefix.
+	Version string
+
+	// GoExec is the go executable to run.
+	GoExec string
+
+	// Env holds the environment variables selecting the toolchain.
+	Env []string
+}
+
+// Command returns a command running the toolchain inside the directory.
+func (t *Toolchain) Command(dir string) *builder.InDirCommand {
+	return builder.InDir(dir, t.GoExec).WithEnv(t.Env...)
+}
+
+// Toolchains keeps track of the go on the PATH, the unpacked toolchains and the archives in the mirror directory.
+type Toolchains struct {
+	cacheDir  string
+	mirrorDir string
+	download  bool
+
+	system        string
+	systemVersion string
+
+	mu        sync.Mutex
+	installed map[string]string     // version -> go executable
+	archives  map[string]string     // version -> archive in the mirror
+	unpacking map[string]*unpacking // version -> unpack in progress
+}
+
+// unpacking is the unpack of a toolchain from the mirror, shared by all builds waiting for the toolchain.
+type unpacking struct {
+	once   sync.Once
+	goexec string
+	err    error
+}
+
+// NewToolchains discovers the toolchains, with the mirror holding go.dev archives like go1.22.5.linux-amd64.tar.gz.
+func NewToolchains(ctx context.Context, cacheDir string, mirrorDir string, download bool) (*Toolchains, error) {
+	if mirrorDir != "" && cacheDir == "" {
+		return nil, fmt.Errorf("a toolchain cache directory is required to unpack the toolchains from the mirror")
+	}
+
+	t := &Toolchains{
+		cacheDir:  cacheDir,
+		mirrorDir: mirrorDir,
+		download:  download,
+		installed: map[string]string{},
+		archives:  map[string]string{},
+		unpacking: map[string]*unpacking{},
+	}
+
+	if goexec, err := exec.LookPath("go"); err == nil {
+		version, err := builder.InDir("", goexec).WithEnv("GOTOOLCHAIN=local").GoVersion(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the version of %s: %w", goexec, err)
+		}
+
+		t.system, t.systemVersion = goexec, version
+		t.installed[version] = goexec
+	}
+
+	if download && (t.system == "" || compareVersions(t.systemVersion, minSwitchableVersion) < 0) {
+		return nil, fmt.Errorf("downloading toolchains requires go %s or later on the PATH", minSwitchableVersion)
+	}
+
+	if cacheDir != "" {
+		entries, err := os.ReadDir(cacheDir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read toolchain cache: %w", err)
+		}
+
+		for _, e := range entries {
+			goexec := filepath.Join(cacheDir, e.Name(), "bin", "go")
+			if !e.IsDir() || !strings.HasPrefix(e.Name(), "go") {
+				continue
+			}
+
+			if _, err := os.Stat(goexec); err == nil {
+				t.installed[strings.TrimPrefix(e.Name(), "go")] = goexec
+			}
+		}
+	}
+
+	if mirrorDir != "" {
+		entries, err := os.ReadDir(mirrorDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read toolchain mirror: %w", err)
+		}
+
+		pattern := regexp.MustCompile(fmt.Sprintf(`^go(.+)\.%s-%s\.tar\.gz$`, runtime.GOOS, runtime.GOARCH))
+		for _, e := range entries {
+			if m := pattern.FindStringSubmatch(e.Name()); m != nil {
+				t.archives[m[1]] = filepath.Join(mirrorDir, e.Name())
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// Versions returns the versions of the toolchains which are installed or can be unpacked from the mirror.
+func (t *Toolchains) Versions() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.versions()
+}
+
+// System returns the toolchain of the go on the PATH, or nil if there is none.
+func (t *Toolchains) System() *Toolchain {
+	if t.system == "" {
+		return nil
+	}
+
+	return &Toolchain{Version: t.systemVersion, GoExec: t.system, Env: []string{"GOTOOLCHAIN=local"}}
+}
+
+// Download tells whether toolchains missing locally are downloaded through GOTOOLCHAIN.
+func (t *Toolchains) Download() bool {
+	return t.download
+}
+
+// Supports tells whether a build asking for the given go version can be built.
+func (t *Toolchains) Supports(version string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, ok := t.match(version)
+	return ok
+}
+
+// Resolve returns the toolchain for the go version, unpacking it from the mirror if needed.
+func (t *Toolchains) Resolve(ctx context.Context, version string) (*Toolchain, error) {
+	tc, err := t.lookup(version)
+	if err != nil {
+		return nil, err
+	}
+
+	// -- running go version makes the go command fetch the toolchain when it is selected through GOTOOLCHAIN
+	actual, err := tc.Command("").GoVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the version of go %s: %w", tc.Version, err)
+	}
+
+	if actual != tc.Version {
+		return nil, fmt.Errorf("toolchain for go %s reports version %s", tc.Version, actual)
+	}
+
+	return tc, nil
+}
+
+// lookup returns the toolchain for the version, unpacking it without holding the lock.
+func (t *Toolchains) lookup(version string) (*Toolchain, error) {
+	t.mu.Lock()
+	v, ok := t.match(version)
+	if !ok {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("no toolchain available for go %s", version)
+	}
+
+	if goexec, fnd := t.installed[v]; fnd {
+		t.mu.Unlock()
+		return &Toolchain{Version: v, GoExec: goexec, Env: []string{"GOTOOLCHAIN=local"}}, nil
+	}
+
+	archive, fnd := t.archives[v]
+	if !fnd {
+		t.mu.Unlock()
+		return &Toolchain{Version: v, GoExec: t.system, Env: []string{fmt.Sprintf("GOTOOLCHAIN=go%s", v)}}, nil
+	}
+
+	u, fnd := t.unpacking[v]
+	if !fnd {
+		u = &unpacking{}
+		t.unpacking[v] = u
+	}
+	t.mu.Unlock()
+
+	u.once.Do(func() {
+		u.goexec, u.err = t.unpack(v, archive)
+	})
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// -- a failed unpack is forgotten, so the next build tries again
+	if t.unpacking[v] == u {
+		delete(t.unpacking, v)
+	}
+
+	if u.err != nil {
+		return nil, fmt.Errorf("failed to unpack go %s: %w", v, u.err)
+	}
+
+	t.installed[v] = u.goexec
+	return &Toolchain{Version: v, GoExec: u.goexec, Env: []string{"GOTOOLCHAIN=local"}}, nil
+}
+
+// match picks the toolchain for a version; 1.22 takes the latest 1.22.x, a full version must match exactly.
+func (t *Toolchains) match(version string) (string, bool) {
+	version = strings.TrimPrefix(version, "go")
+	if version == "" {
+		return "", false
+	}
+
+	var best string
+	for _, v := range t.versions() {
+		if v == version {
+			return v, true
+		}
+
+		if strings.HasPrefix(v, version+".") && (best == "" || compareVersions(v, best) > 0) {
+			best = v
+		}
+	}
+
+	if best != "" {
+		return best, true
+	}
+
+	// -- the go command only knows toolchains by their full release version
+	if t.download && strings.Count(version, ".") == 2 && compareVersions(version, minSwitchableVersion) >= 0 {
+		return version, true
+	}
+
+	return "", false
+}
+
+func (t *Toolchains) versions() []string {
+	seen := map[string]bool{}
+	for v := range t.installed {
+		seen[v] = true
+	}
+	for v := range t.archives {
+		seen[v] = true
+	}
+
+	result := make([]string, 0, len(seen))
+	for v := range seen {
+		result = append(result, v)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return compareVersions(result[i], result[j]) < 0
+	})
+
+	return result
+}
+
+// unpack extracts the archive into the cache as go<version> and returns the path of its go executable.
+func (t *Toolchains) unpack(version string, archive string) (string, error) {
+	log.Info().Msgf("unpacking go %s from %s", version, archive)
+
+	if err := os.MkdirAll(t.cacheDir, 0755); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.MkdirTemp(t.cacheDir, ".unpack-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := extractTarGz(archive, tmp); err != nil {
+		return "", err
+	}
+
+	target := filepath.Join(t.cacheDir, "go"+version)
+	if err := os.Rename(filepath.Join(tmp, "go"), target); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(target, "bin", "go"), nil
+}
+
+// extractTarGz extracts the directories and regular files of the archive into dir.
+func extractTarGz(archive string, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, hdr.Name)
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("archive entry %s points outside of the target directory", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+
+			if err := extractFile(tr, target, os.FileMode(hdr.Mode)&os.ModePerm); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func extractFile(r io.Reader, target string, mode os.FileMode) error {
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// compareVersions orders go versions like 1.22.5, with pre-releases like 1.23rc1 before the release.
+func compareVersions(a string, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		na, ra := versionPart(pa, i)
+		nb, rb := versionPart(pb, i)
+		if na != nb {
+			return na - nb
+		}
+		if ra != rb {
+			// -- a part without a pre-release suffix is the final release
+			switch {
+			case ra == "":
+				return 1
+			case rb == "":
+				return -1
+			default:
+				return strings.Compare(ra, rb)
+			}
+		}
+	}
+
+	return 0
+}
+
+// versionPart splits the i-th part of a version into its number and pre-release suffix. Missing parts count as 0.
+func versionPart(parts []string, i int) (int, string) {
+	if i >= len(parts) {
+		return 0, ""
+	}
+
+	p := parts[i]
+	digits := strings.IndexFunc(p, func(r rune) bool { return r < '0' || r > '9' })
+	if digits < 0 {
+		digits = len(p)
+	}
+
+	n, _ := strconv.Atoi(p[:digits])
+	return n, p[digits:]
+}
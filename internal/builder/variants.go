@@ -0,0 +1,203 @@
+package builder
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"github.com/wombatwisdom/wombat-builder/signing"
+	"io"
+	"os"
+	"path"
+	"time"
+)
+
+// Compression is a content encoding in which artifacts can additionally be stored next to the plain binary.
+type Compression string
+
+const (
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+func (c Compression) Valid() bool {
+	return c == CompressionGzip || c == CompressionZstd
+}
+
+// manifest describes the binary in an archive bundle.
+type manifest struct {
+	Id string `json:"id"`
+	model.BuildIdentity
+	Sha256  string         `json:"sha256"`
+	Modules []model.Module `json:"modules"`
+}
+
+// compress writes a copy of the executable in the given encoding next to it and returns its path.
+func compress(out *BuildOutput, c Compression) (string, error) {
+	var target string
+	var wrap func(w io.Writer) (io.WriteCloser, error)
+
+	switch c {
+	case CompressionGzip:
+		target = out.Executable + ".gz"
+		wrap = func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, gzip.BestCompression)
+		}
+	case CompressionZstd:
+		target = out.Executable + ".zst"
+		wrap = func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+		}
+	default:
+		return "", fmt.Errorf("unsupported compression %q", c)
+	}
+
+	err := writeTo(target, func(w io.Writer) error {
+		cw, err := wrap(w)
+		if err != nil {
+			return err
+		}
+
+		if err := copyFile(cw, out.Executable); err != nil {
+			return err
+		}
+
+		return cw.Close()
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to compress using %s: %w", c, err)
+	}
+
+	return target, nil
+}
+
+// bundle archives the binary and a build manifest, as a zip for windows and a tar.gz everywhere else.
+func bundle(id string, build *model.Build, out *BuildOutput) (string, error) {
+	m, err := newManifest(id, build, out)
+	if err != nil {
+		return "", err
+	}
+
+	binary, err := os.ReadFile(out.Executable)
+	if err != nil {
+		return "", err
+	}
+
+	entries := []bundleEntry{
+		{name: "wombat", mode: 0755, data: binary},
+		{name: "manifest.json", mode: 0644, data: m},
+	}
+
+	if build.Goos == "windows" {
+		entries[0].name = "wombat.exe"
+		target := path.Join(path.Dir(out.Executable), "bundle.zip")
+		return target, writeTo(target, func(w io.Writer) error {
+			return writeZip(w, entries)
+		})
+	}
+
+	target := path.Join(path.Dir(out.Executable), "bundle.tar.gz")
+	return target, writeTo(target, func(w io.Writer) error {
+		return writeTarGz(w, entries)
+	})
+}
+
+type bundleEntry struct {
+	name string
+	mode int64
+	data []byte
+}
+
+func writeZip(w io.Writer, entries []bundleEntry) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: time.Now()}
+		hdr.SetMode(os.FileMode(e.mode))
+
+		ew, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+
+		if _, err := ew.Write(e.data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func writeTarGz(w io.Writer, entries []bundleEntry) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: e.mode, Size: int64(len(e.data)), ModTime: time.Now(), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if _, err := tw.Write(e.data); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gw.Close()
+}
+
+func newManifest(id string, build *model.Build, out *BuildOutput) ([]byte, error) {
+	f, err := os.Open(out.Executable)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	digest, err := signing.Sha256(f)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := os.ReadFile(out.ModuleList)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(manifest{
+		Id:            id,
+		BuildIdentity: build.BuildIdentity,
+		Sha256:        digest,
+		Modules:       model.ParseModuleList(list),
+	}, "", "  ")
+}
+
+// writeTo creates the file at the given path and lets fn write its content.
+func writeTo(target string, fn func(w io.Writer) error) error {
+	f, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := fn(f); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func copyFile(w io.Writer, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"errors"
+	"github.com/wombatwisdom/wombat-builder/library"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"io/fs"
+	"strings"
+)
+
+// moduleAccess collects the access settings of the private libraries the packages belong to.
+func moduleAccess(lc library.Client, packages []model.Package) ([]model.ModuleAccess, error) {
+	// -- without a catalog, there are no private libraries either
+	ids, err := lc.Libraries()
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var private []library.Spec
+	for _, id := range ids {
+		lib, err := lc.Library(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if lib.Access != nil {
+			private = append(private, *lib)
+		}
+	}
+
+	var result []model.ModuleAccess
+	seen := map[string]bool{}
+	for _, p := range packages {
+		for _, lib := range private {
+			if seen[lib.Name] || !(p.Library == lib.Name || p.Url == lib.Module || strings.HasPrefix(p.Url, lib.Module+"/")) {
+				continue
+			}
+
+			seen[lib.Name] = true
+			result = append(result, model.ModuleAccess{
+				Module:   lib.Module,
+				Private:  lib.Access.Private,
+				Proxy:    lib.Access.Proxy,
+				Host:     lib.Access.Host,
+				Secret:   lib.Access.Secret,
+				Username: lib.Access.Username,
+			})
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"context"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+)
+
+type (
+	BuilderListRequest struct{}
+
+	BuilderListResponse struct {
+		Builders []model.BuilderLease `json:"builders" jsonschema_description:"The builders which are currently alive"`
+	}
+)
+
+func getBuilderListHandler(s *store.Store) micro.HandlerFunc {
+	return func(request micro.Request) {
+		leases, err := s.Builders.List(context.Background())
+		if err != nil {
+			respondStoreError(request, "failed to list builders", err)
+			return
+		}
+
+		if err := request.RespondJSON(BuilderListResponse{Builders: leases}); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+			return
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+)
+
+type (
+	BuildCancelRequest struct {
+		Id string `json:"id" jsonschema_description:"The ID of the build to cancel"`
+	}
+
+	BuildCancelResponse struct {
+		Id     string            `json:"id" jsonschema_description:"The ID of the build"`
+		Status model.BuildStatus `json:"status" jsonschema_description:"The status of the build"`
+	}
+)
+
+func (r *BuildCancelRequest) Validate() error {
+	if r.Id == "" {
+		return ErrMissingField("id")
+	}
+
+	return nil
+}
+
+func getBuildCancelHandler(s *store.Store) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req BuildCancelRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+
+		build, rev, err := s.Builds.GetWithRevision(context.Background(), req.Id)
+		if err != nil {
+			respondStoreError(request, "failed to get build", err)
+			return
+		}
+
+		if build.Status.IsTerminal() {
+			_ = request.Error("BAD_REQUEST", "build can no longer be cancelled", []byte(fmt.Sprintf("build is %s", build.Status)))
+			return
+		}
+
+		// -- the builder owning the build is watching the key and will abort as soon as it sees the new status
+		build.Status = model.BuildStatusCancelled
+		build.Builder = ""
+		if _, err := s.Builds.Update(context.Background(), req.Id, build, rev); err != nil {
+			respondStoreError(request, "failed to cancel build", err)
+			return
+		}
+
+		if err := request.RespondJSON(BuildCancelResponse{Id: req.Id, Status: build.Status}); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+			return
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+)
+
+// storeErrorCode maps an error returned by the store onto the error code reported to the client.
+func storeErrorCode(err error) string {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return "NOT_FOUND"
+	case errors.Is(err, store.ErrConflict):
+		return "CONFLICT"
+	case errors.Is(err, store.ErrBackbone):
+		return "BACKBONE_ERROR"
+	default:
+		return "INTERNAL_ERROR"
+	}
+}
+
+func respondStoreError(request micro.Request, description string, err error) {
+	_ = request.Error(storeErrorCode(err), description, []byte(err.Error()))
+}
+
+// badRequestError is returned by the helpers shared between handlers when what the client asked for is invalid.
+type badRequestError struct {
+	description string
+	err         error
+}
+
+func (e badRequestError) Error() string {
+	return fmt.Sprintf("%s: %v", e.description, e.err)
+}
+
+func (e badRequestError) Unwrap() error {
+	return e.err
+}
+
+// respondRequestError reports an error of the shared helpers; anything but a badRequestError is a store error.
+func respondRequestError(request micro.Request, err error) {
+	var bre badRequestError
+	if errors.As(err, &bre) {
+		_ = request.Error("BAD_REQUEST", bre.description, []byte(bre.err.Error()))
+		return
+	}
+
+	respondStoreError(request, "failed to request build", err)
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog/log"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetentionPolicy decides which builds are garbage collected; builds in progress and pinned builds are kept.
+type RetentionPolicy struct {
+	// KeepLast is the number of successful builds kept per package set and platform; 0 keeps all of them.
+	KeepLast int
+
+	// MaxIdle removes builds which have not been downloaded for this long, 0 disables expiry.
+	MaxIdle time.Duration
+
+	// Interval is the time between two garbage collections.
+	Interval time.Duration
+}
+
+type (
+	GcReport struct {
+		DryRun          bool           `json:"dryRun" jsonschema_description:"Whether anything was actually removed"`
+		Builds          []GcBuild      `json:"builds" jsonschema_description:"The builds which were (or would be) removed"`
+		OrphanedObjects []string       `json:"orphanedObjects" jsonschema_description:"Objects which no longer belonged to any build"`
+		ReclaimedBytes  uint64         `json:"reclaimedBytes" jsonschema_description:"The amount of storage reclaimed in bytes"`
+		Errors          []string       `json:"errors,omitempty" jsonschema_description:"The problems encountered while removing builds"`
+		Duration        model.Duration `json:"duration" jsonschema_description:"The time the collection took"`
+	}
+
+	GcBuild struct {
+		Id      string `json:"id" jsonschema_description:"The ID of the build"`
+		Reason  string `json:"reason" jsonschema_description:"Why the build was removed"`
+		Objects int    `json:"objects" jsonschema_description:"The number of objects stored for the build"`
+		Bytes   uint64 `json:"bytes" jsonschema_description:"The size of the objects stored for the build"`
+	}
+)
+
+// collector runs the garbage collection, making sure only one collection runs at a time within the service.
+type collector struct {
+	s      *store.Store
+	policy RetentionPolicy
+	mu     sync.Mutex
+}
+
+// run periodically removes the builds the retention policy no longer wants to keep.
+func (c *collector) run(ctx context.Context) {
+	if c.policy.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.policy.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := c.collect(ctx, false)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to collect garbage")
+				continue
+			}
+
+			if len(report.Builds) > 0 || len(report.OrphanedObjects) > 0 {
+				log.Info().Msgf("garbage collection removed %d builds and %d orphaned objects, reclaiming %d bytes",
+					len(report.Builds), len(report.OrphanedObjects), report.ReclaimedBytes)
+			}
+		}
+	}
+}
+
+// collect removes the builds not retained by the policy and any orphaned objects, unless running dry.
+func (c *collector) collect(ctx context.Context, dryRun bool) (*GcReport, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	start := time.Now()
+
+	// -- the objects are listed before the builds, so objects of builds created in between are never seen as orphans
+	objects, err := c.s.Artifacts.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+
+	entries, err := c.s.Builds.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list builds: %w", err)
+	}
+
+	owned := map[string][]*jetstream.ObjectInfo{}
+	for _, oi := range objects {
+		// -- only objects named after a build are ever touched
+		if oi.Deleted || !strings.HasPrefix(oi.Name, "build.") {
+			continue
+		}
+		owner := objectOwner(oi.Name)
+		owned[owner] = append(owned[owner], oi)
+	}
+
+	report := &GcReport{DryRun: dryRun, Builds: []GcBuild{}, OrphanedObjects: []string{}}
+	reasons := c.policy.evaluate(entries, owned, start)
+
+	for _, entry := range entries {
+		id := entry.Build.Id()
+		objs := owned[id]
+		delete(owned, id)
+
+		reason, fnd := reasons[id]
+		if !fnd {
+			continue
+		}
+
+		gb := GcBuild{Id: id, Reason: reason, Objects: len(objs)}
+		for _, oi := range objs {
+			gb.Bytes += oi.Size
+		}
+
+		if !dryRun {
+			if err := c.remove(ctx, entry, objs); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", id, err))
+				continue
+			}
+		}
+
+		report.Builds = append(report.Builds, gb)
+		report.ReclaimedBytes += gb.Bytes
+	}
+
+	// -- whatever is left belongs to builds which no longer exist
+	for _, objs := range owned {
+		for _, oi := range objs {
+			if !dryRun {
+				if err := c.s.Artifacts.Delete(ctx, oi.Name); err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", oi.Name, err))
+					continue
+				}
+			}
+
+			report.OrphanedObjects = append(report.OrphanedObjects, oi.Name)
+			report.ReclaimedBytes += oi.Size
+		}
+	}
+
+	report.Duration = model.Duration(time.Since(start))
+	return report, nil
+}
+
+// remove deletes the build before its objects and logs, leaving it alone if it changed since it was listed.
+func (c *collector) remove(ctx context.Context, entry store.BuildEntry, objs []*jetstream.ObjectInfo) error {
+	id := entry.Build.Id()
+	if err := c.s.Builds.Delete(ctx, id, entry.Revision); err != nil {
+		return err
+	}
+
+	for _, oi := range objs {
+		if err := c.s.Artifacts.Delete(ctx, oi.Name); err != nil {
+			return err
+		}
+	}
+
+	if err := c.s.Stats.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	return c.s.Logs.Purge(ctx, id)
+}
+
+// evaluate returns the builds which are not retained by the policy, together with the reason why.
+func (p RetentionPolicy) evaluate(entries []store.BuildEntry, owned map[string][]*jetstream.ObjectInfo, now time.Time) map[string]string {
+	result := map[string]string{}
+
+	groups := map[string][]store.BuildEntry{}
+	for _, entry := range entries {
+		if !entry.Build.Status.IsTerminal() {
+			continue
+		}
+
+		key := packageSet(entry.Build)
+		groups[key] = append(groups[key], entry)
+
+		if entry.Build.Pinned || p.MaxIdle <= 0 {
+			continue
+		}
+
+		if idle := now.Sub(lastUsed(entry, owned[entry.Build.Id()])); idle > p.MaxIdle {
+			result[entry.Build.Id()] = fmt.Sprintf("not downloaded for %d days", int(idle.Hours()/24))
+		}
+	}
+
+	if p.KeepLast <= 0 {
+		return result
+	}
+
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool {
+			return group[i].UpdatedAt.After(group[j].UpdatedAt)
+		})
+
+		newer := 0
+		for _, entry := range group {
+			_, fnd := result[entry.Build.Id()]
+			if newer >= p.KeepLast && !fnd && !entry.Build.Pinned {
+				result[entry.Build.Id()] = fmt.Sprintf("more than %d newer successful builds of the same packages", p.KeepLast)
+			}
+
+			if entry.Build.Status == model.BuildStatusSuccess {
+				newer++
+			}
+		}
+	}
+
+	return result
+}
+
+// lastUsed returns the last time any object of the build was downloaded, or the build was last written.
+func lastUsed(entry store.BuildEntry, objs []*jetstream.ObjectInfo) time.Time {
+	result := entry.UpdatedAt
+	for _, oi := range objs {
+		if t := store.LastDownload(oi); t.After(result) {
+			result = t
+		}
+	}
+
+	return result
+}
+
+// packageSet identifies the packages of a build on a platform, ignoring the versions they were built at.
+func packageSet(build *model.Build) string {
+	return fmt.Sprintf("%s/%s/%s", build.Goos, build.Goarch, joinUrls(packageUrls(build)))
+}
+
+// packageUrls returns the sorted import paths of the packages in the build.
+func packageUrls(build *model.Build) []string {
+	urls := make([]string, 0, len(build.Packages))
+	for _, p := range build.Packages {
+		urls = append(urls, p.Url)
+	}
+	sort.Strings(urls)
+
+	return urls
+}
+
+func joinUrls(urls []string) string {
+	return strings.Join(urls, ",")
+}
+
+// objectOwner returns the id of the build an object is named after, dropping suffixes like .sha256.
+func objectOwner(name string) string {
+	parts := strings.SplitN(name, ".", 6)
+	if len(parts) < 5 {
+		return name
+	}
+
+	return strings.Join(parts[:5], ".")
+}
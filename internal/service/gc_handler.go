@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nats-io/nats.go/micro"
+)
+
+type GcRequest struct {
+	DryRun bool `json:"dryRun" jsonschema_description:"Only report what would be removed"`
+}
+
+func getGcHandler(c *collector) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req GcRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		report, err := c.collect(context.Background(), req.DryRun)
+		if err != nil {
+			respondStoreError(request, "failed to collect garbage", err)
+			return
+		}
+
+		if err := request.RespondJSON(report); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+)
+
+type (
+	BuildGetRequest struct {
+		Id string `json:"id" jsonschema_description:"The ID of the build"`
+	}
+
+	BuildGetResponse struct {
+		Id    string      `json:"id" jsonschema_description:"The ID of the build"`
+		Build model.Build `json:"build" jsonschema_description:"The build, including the progress of its phases"`
+	}
+)
+
+func (r *BuildGetRequest) Validate() error {
+	if r.Id == "" {
+		return ErrMissingField("id")
+	}
+
+	return nil
+}
+
+func getBuildGetHandler(s *store.Store) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req BuildGetRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+
+		build, err := s.Builds.Get(context.Background(), req.Id)
+		if err != nil {
+			respondStoreError(request, "failed to get build", err)
+			return
+		}
+
+		if err := request.RespondJSON(BuildGetResponse{Id: req.Id, Build: *build}); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+			return
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"time"
+)
+
+type (
+	BuildGroupRequest struct {
+		Id string `json:"id" jsonschema_description:"The ID of the group"`
+	}
+
+	BuildGroupResponse struct {
+		Id        string                    `json:"id" jsonschema_description:"The ID of the group"`
+		Status    model.BuildStatus         `json:"status" jsonschema_description:"The status of the group as a whole. The group is building until all of its builds finished and only succeeds if all of them did. Expired builds are left out"`
+		Counts    map[model.BuildStatus]int `json:"counts" jsonschema_description:"The number of builds in each status"`
+		Builds    []BuildGroupMember        `json:"builds" jsonschema_description:"The builds in the group"`
+		CreatedAt time.Time                 `json:"createdAt" jsonschema_description:"When the group was requested"`
+	}
+
+	BuildGroupMember struct {
+		Id        string                  `json:"id" jsonschema_description:"The ID of the build"`
+		Goos      string                  `json:"goos,omitempty" jsonschema_description:"The target operating system"`
+		Goarch    string                  `json:"goarch,omitempty" jsonschema_description:"The target architecture"`
+		GoVersion string                  `json:"goVersion,omitempty" jsonschema_description:"The Go version"`
+		Status    model.BuildStatus       `json:"status" jsonschema_description:"The status of the build"`
+		Error     string                  `json:"error,omitempty" jsonschema_description:"Why the build failed"`
+		Artifact  model.ArtifactReference `json:"artifact,omitempty" jsonschema_description:"The artifact of the build, once it succeeded"`
+	}
+)
+
+func (r *BuildGroupRequest) Validate() error {
+	if r.Id == "" {
+		return ErrMissingField("id")
+	}
+
+	return nil
+}
+
+func getBuildGroupHandler(s *store.Store) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req BuildGroupRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+
+		group, err := s.Groups.Get(context.Background(), req.Id)
+		if err != nil {
+			respondStoreError(request, "failed to get group", err)
+			return
+		}
+
+		result := BuildGroupResponse{
+			Id:        group.Id,
+			Counts:    map[model.BuildStatus]int{},
+			CreatedAt: group.CreatedAt,
+		}
+
+		var statuses []model.BuildStatus
+		for _, id := range group.Builds {
+			member := BuildGroupMember{Id: id}
+
+			build, err := s.Builds.Get(context.Background(), id)
+			switch {
+			case err == nil:
+				member.Goos = build.Goos
+				member.Goarch = build.Goarch
+				member.GoVersion = build.GoVersion
+				member.Status = build.Status
+				member.Error = build.Error
+				member.Artifact = build.Artifact
+			case errors.Is(err, store.ErrNotFound):
+				// -- the build was removed since, most likely by the garbage collection
+				member.Status = model.BuildStatusExpired
+			default:
+				respondStoreError(request, "failed to get build", err)
+				return
+			}
+
+			statuses = append(statuses, member.Status)
+			result.Counts[member.Status]++
+			result.Builds = append(result.Builds, member)
+		}
+		result.Status = model.GroupStatus(statuses...)
+
+		if err := request.RespondJSON(result); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+			return
+		}
+	}
+}
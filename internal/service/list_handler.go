@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/nats-io/nats.go/micro"
 	"github.com/rs/zerolog/log"
 	"github.com/wombatwisdom/wombat-builder/internal/store"
@@ -45,7 +46,10 @@ func getBuildListHandler(s *store.Store) micro.HandlerFunc {
 		for _, id := range ids {
 			build, err := s.Builds.Get(context.Background(), id)
 			if err != nil {
-				log.Warn().Err(err).Msgf("failed to get build %s", id)
+				// -- the index is eventually consistent, so it may still refer to builds which are gone
+				if !errors.Is(err, store.ErrNotFound) {
+					log.Warn().Err(err).Msgf("failed to get build %s", id)
+				}
 				continue
 			}
 			result = append(result, *build)
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+)
+
+type (
+	BuildLogsRequest struct {
+		Id string `json:"id" jsonschema_description:"The ID of the build to get the log for"`
+	}
+
+	BuildLogsResponse struct {
+		Id    string   `json:"id" jsonschema_description:"The ID of the build"`
+		Lines []string `json:"lines" jsonschema_description:"The output of the go toolchain, one entry per line"`
+	}
+)
+
+func (r *BuildLogsRequest) Validate() error {
+	if r.Id == "" {
+		return ErrMissingField("id")
+	}
+
+	return nil
+}
+
+func getBuildLogsHandler(s *store.Store) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req BuildLogsRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+
+		lines, err := s.Logs.Read(context.Background(), req.Id)
+		if err != nil {
+			respondStoreError(request, "failed to read build log", err)
+			return
+		}
+
+		if err := request.RespondJSON(BuildLogsResponse{Id: req.Id, Lines: lines}); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+			return
+		}
+	}
+}
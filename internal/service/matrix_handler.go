@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/rs/xid"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"github.com/wombatwisdom/wombat-builder/library"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"time"
+)
+
+type (
+	BuildMatrixRequest struct {
+		Goos       []string         `json:"goos,omitempty" jsonschema_description:"The target operating systems, combined with every target architecture"`
+		Goarch     []string         `json:"goarch,omitempty" jsonschema_description:"The target architectures, combined with every target operating system"`
+		GoVersions []string         `json:"goVersions" jsonschema_description:"The Go versions to use. Every target is built with every version"`
+		Targets    []BuildTarget    `json:"targets,omitempty" jsonschema_description:"Additional operating system and architecture combinations to build for"`
+		Packages   []PackageRequest `json:"packages" jsonschema_description:"The packages to build. Either import paths, optionally pinned to a module version, or references into the library catalog"`
+		Force      bool             `json:"force" jsonschema_description:"Whether to force a rebuild"`
+		Cgo        bool             `json:"cgo,omitempty" jsonschema_description:"Whether to build with cgo enabled. Only builders with a C compiler for the target take up the build"`
+		Plugin     bool             `json:"plugin,omitempty" jsonschema_description:"Whether to build go plugins instead of executables. Only builders running on the target platform take up the build"`
+
+		Distribution *model.Distribution `json:"distribution,omitempty" jsonschema_description:"Brands the binaries with a name, version, banner and default config paths"`
+
+		Priority int `json:"priority,omitempty" jsonschema_description:"Builds with a higher priority are built first, like release builds ahead of ad-hoc requests. Ranges from -10 to 10, defaults to 0"`
+
+		// Requester is who sent the request, which is taken from the transport rather than the body.
+		Requester string `json:"-"`
+
+		MaxAttempts int                  `json:"maxAttempts,omitempty" jsonschema_description:"How many times each build may be attempted when it fails for transient reasons. Defaults to 3"`
+		Timeouts    *model.PhaseTimeouts `json:"timeouts,omitempty" jsonschema_description:"Overrides the builder timeouts of the get, tidy and build phases, expressed as durations like 10m"`
+	}
+
+	BuildTarget struct {
+		Goos   string `json:"goos" jsonschema_description:"The target operating system"`
+		Goarch string `json:"goarch" jsonschema_description:"The target architecture"`
+	}
+
+	BuildMatrixResponse struct {
+		GroupId string                 `json:"groupId" jsonschema_description:"The ID of the group holding the builds"`
+		Builds  []BuildRequestResponse `json:"builds" jsonschema_description:"The builds the matrix fanned out into"`
+	}
+)
+
+func (r *BuildMatrixRequest) Validate() error {
+	if len(r.Goos) != 0 && len(r.Goarch) == 0 {
+		return ErrMissingField("goarch")
+	}
+
+	if len(r.Goarch) != 0 && len(r.Goos) == 0 {
+		return ErrMissingField("goos")
+	}
+
+	for i, t := range r.Targets {
+		if t.Goos == "" || t.Goarch == "" {
+			return fmt.Errorf("invalid target %d: both goos and goarch are required", i)
+		}
+	}
+
+	if len(r.targets()) == 0 {
+		return ErrMissingField("targets")
+	}
+
+	if len(r.GoVersions) == 0 {
+		return ErrMissingField("goVersions")
+	}
+
+	if len(r.Packages) == 0 {
+		return ErrMissingField("packages")
+	}
+
+	for i := range r.Packages {
+		if err := r.Packages[i].Validate(); err != nil {
+			return fmt.Errorf("invalid package %d: %w", i, err)
+		}
+	}
+
+	if r.MaxAttempts < 0 {
+		return errors.New("maxAttempts can not be negative")
+	}
+
+	if err := validatePriority(r.Priority); err != nil {
+		return err
+	}
+
+	if r.Distribution != nil {
+		if err := r.Distribution.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// targets returns every combination of the operating systems and architectures plus the explicit targets, once each.
+func (r *BuildMatrixRequest) targets() []BuildTarget {
+	var result []BuildTarget
+	seen := map[BuildTarget]bool{}
+	add := func(t BuildTarget) {
+		if !seen[t] {
+			seen[t] = true
+			result = append(result, t)
+		}
+	}
+
+	for _, goos := range r.Goos {
+		for _, goarch := range r.Goarch {
+			add(BuildTarget{Goos: goos, Goarch: goarch})
+		}
+	}
+
+	for _, t := range r.Targets {
+		add(t)
+	}
+
+	return result
+}
+
+// requests fans the matrix out into a build request per target and Go version.
+func (r *BuildMatrixRequest) requests() []BuildRequestRequest {
+	var result []BuildRequestRequest
+	for _, t := range r.targets() {
+		for _, v := range r.GoVersions {
+			result = append(result, BuildRequestRequest{
+				Goos:         t.Goos,
+				Goarch:       t.Goarch,
+				GoVersion:    v,
+				Packages:     r.Packages,
+				Force:        r.Force,
+				Cgo:          r.Cgo,
+				Plugin:       r.Plugin,
+				Distribution: r.Distribution,
+				Priority:     r.Priority,
+				Requester:    r.Requester,
+				MaxAttempts:  r.MaxAttempts,
+				Timeouts:     r.Timeouts,
+			})
+		}
+	}
+
+	return result
+}
+
+func getBuildMatrixHandler(s *store.Store, lc library.Client, q *requesters) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req BuildMatrixRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+		req.Requester = q.of(request)
+
+		result, err := requestMatrix(context.Background(), s, lc, req)
+		if err != nil {
+			respondRequestError(request, err)
+			return
+		}
+
+		if err := request.RespondJSON(result); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+			return
+		}
+	}
+}
+
+// requestMatrix requests the builds of the matrix and groups them. Request errors are badRequestErrors.
+func requestMatrix(ctx context.Context, s *store.Store, lc library.Client, req BuildMatrixRequest) (BuildMatrixResponse, error) {
+	// -- validate all builds up front, so an invalid request does not leave half of the matrix behind
+	for _, br := range req.requests() {
+		if err := br.Validate(); err != nil {
+			return BuildMatrixResponse{}, badRequestError{description: "invalid request", err: err}
+		}
+	}
+
+	result := BuildMatrixResponse{GroupId: fmt.Sprintf("group.%s", xid.New().String())}
+	for _, br := range req.requests() {
+		resp, err := requestBuild(ctx, s, lc, br)
+		if err != nil {
+			return BuildMatrixResponse{}, err
+		}
+		result.Builds = append(result.Builds, resp)
+	}
+
+	group := model.BuildGroup{Id: result.GroupId, CreatedAt: time.Now().UTC()}
+	for _, b := range result.Builds {
+		group.Builds = append(group.Builds, b.Id)
+	}
+
+	if err := s.Groups.Create(ctx, group); err != nil {
+		return BuildMatrixResponse{}, fmt.Errorf("failed to store group: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"io"
+)
+
+type (
+	BuildModulesRequest struct {
+		Id string `json:"id" jsonschema_description:"The ID of the build"`
+	}
+
+	BuildModulesResponse struct {
+		Id      string         `json:"id" jsonschema_description:"The ID of the build"`
+		GoMod   string         `json:"goMod" jsonschema_description:"The go.mod the artifact was built with"`
+		GoSum   string         `json:"goSum,omitempty" jsonschema_description:"The go.sum the artifact was built with"`
+		Modules []model.Module `json:"modules" jsonschema_description:"Every module in the build list, as reported by go list -m all"`
+	}
+)
+
+func (r *BuildModulesRequest) Validate() error {
+	if r.Id == "" {
+		return ErrMissingField("id")
+	}
+
+	return nil
+}
+
+func getBuildModulesHandler(s *store.Store) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req BuildModulesRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+
+		build, err := s.Builds.Get(context.Background(), req.Id)
+		if err != nil {
+			respondStoreError(request, "failed to get build", err)
+			return
+		}
+
+		if build.Modules == nil {
+			_ = request.Error("BAD_REQUEST", "no modules recorded for build", []byte(fmt.Sprintf("build is %s", build.Status)))
+			return
+		}
+
+		goMod, err := readArtifact(s, build.Modules.GoMod)
+		if err != nil {
+			respondStoreError(request, "failed to read go.mod", err)
+			return
+		}
+
+		goSum, err := readArtifact(s, build.Modules.GoSum)
+		if err != nil {
+			respondStoreError(request, "failed to read go.sum", err)
+			return
+		}
+
+		list, err := readArtifact(s, build.Modules.List)
+		if err != nil {
+			respondStoreError(request, "failed to read module list", err)
+			return
+		}
+
+		result := BuildModulesResponse{
+			Id:      req.Id,
+			GoMod:   string(goMod),
+			GoSum:   string(goSum),
+			Modules: model.ParseModuleList(list),
+		}
+		if err := request.RespondJSON(result); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+			return
+		}
+	}
+}
+
+// readArtifact returns the content of the referenced artifact, or nothing if there is no reference.
+func readArtifact(s *store.Store, ref model.ArtifactReference) ([]byte, error) {
+	if ref == "" {
+		return nil, nil
+	}
+
+	r, err := s.Artifacts.Read(context.Background(), string(ref))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wombatwisdom/wombat-builder/library"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"golang.org/x/mod/semver"
+	"strings"
+)
+
+// PackageRequest refers to a package to build, by import path (optionally pinned) or by library reference.
+type PackageRequest struct {
+	Url     string `json:"url,omitempty" jsonschema_description:"The import path of the package"`
+	Module  string `json:"module,omitempty" jsonschema_description:"The module providing the package. Defaults to the import path when a version is given"`
+	Version string `json:"version,omitempty" jsonschema_description:"The version of the module to build with, like v1.2.3"`
+
+	Library        string `json:"library,omitempty" jsonschema_description:"The library in the catalog providing the package"`
+	LibraryVersion string `json:"libraryVersion,omitempty" jsonschema_description:"The version of the library to build with"`
+	Package        string `json:"package,omitempty" jsonschema_description:"The name of the package within the library"`
+}
+
+func (r *PackageRequest) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		*r = PackageRequest{}
+		return json.Unmarshal(data, &r.Url)
+	}
+
+	type plain PackageRequest
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+func (r *PackageRequest) Validate() error {
+	if r.Library == "" {
+		if r.Url == "" {
+			return errors.New("a package requires either a url or a library reference")
+		}
+
+		if r.LibraryVersion != "" || r.Package != "" {
+			return ErrMissingField("library")
+		}
+
+		if r.Version != "" && !semver.IsValid(r.Version) {
+			return fmt.Errorf("version %s of %s is not a semantic version", r.Version, r.Url)
+		}
+
+		return nil
+	}
+
+	if r.Url != "" || r.Module != "" || r.Version != "" {
+		return fmt.Errorf("package from library %s can not have a url, module or version", r.Library)
+	}
+
+	if r.LibraryVersion == "" {
+		return ErrMissingField("libraryVersion")
+	}
+
+	if r.Package == "" {
+		return ErrMissingField("package")
+	}
+
+	return nil
+}
+
+// resolve turns the request into a package of the build, pinning library references to the library version.
+func (r *PackageRequest) resolve(lc library.Client) (model.Package, error) {
+	if r.Library == "" {
+		module := r.Module
+		if module == "" && r.Version != "" {
+			module = r.Url
+		}
+
+		return model.Package{Url: r.Url, Module: module, Version: r.Version}, nil
+	}
+
+	lib, err := lc.Library(r.Library)
+	if err != nil {
+		return model.Package{}, err
+	}
+
+	if _, err := lc.Version(r.Library, r.LibraryVersion); err != nil {
+		return model.Package{}, err
+	}
+
+	// -- the library version ends up in go.mod, so it has to be a module version rather than any name
+	if !semver.IsValid(r.LibraryVersion) {
+		return model.Package{}, fmt.Errorf("version %s of library %s is not a semantic version", r.LibraryVersion, r.Library)
+	}
+
+	// -- versions synced from a repository without an earlier version to take the packages from start out empty
+	packages, err := lc.Packages(r.Library, r.LibraryVersion)
+	if err != nil {
+		return model.Package{}, err
+	}
+	if len(packages) == 0 {
+		return model.Package{}, fmt.Errorf("version %s of library %s has no packages in the catalog yet", r.LibraryVersion, r.Library)
+	}
+
+	pkg, err := lc.Package(r.Library, r.LibraryVersion, r.Package)
+	if err != nil {
+		return model.Package{}, err
+	}
+
+	url := lib.Module
+	if p := strings.Trim(pkg.Fqn, "/"); p != "" {
+		url = fmt.Sprintf("%s/%s", lib.Module, p)
+	}
+
+	return model.Package{
+		Url:     url,
+		Module:  lib.Module,
+		Version: r.LibraryVersion,
+		Library: r.Library,
+	}, nil
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+)
+
+type (
+	BuildPinRequest struct {
+		Id     string `json:"id" jsonschema_description:"The ID of the build"`
+		Pinned bool   `json:"pinned" jsonschema_description:"Whether the build should be kept forever"`
+	}
+
+	BuildPinResponse struct {
+		Id     string `json:"id" jsonschema_description:"The ID of the build"`
+		Pinned bool   `json:"pinned" jsonschema_description:"Whether the build is kept forever"`
+	}
+)
+
+func (r *BuildPinRequest) Validate() error {
+	if r.Id == "" {
+		return ErrMissingField("id")
+	}
+
+	return nil
+}
+
+func getBuildPinHandler(s *store.Store) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req BuildPinRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+
+		build, rev, err := s.Builds.GetWithRevision(context.Background(), req.Id)
+		if err != nil {
+			respondStoreError(request, "failed to get build", err)
+			return
+		}
+
+		build.Pinned = req.Pinned
+		if _, err := s.Builds.Update(context.Background(), req.Id, build, rev); err != nil {
+			respondStoreError(request, "failed to pin build", err)
+			return
+		}
+
+		if err := request.RespondJSON(BuildPinResponse{Id: req.Id, Pinned: build.Pinned}); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+			return
+		}
+	}
+}
@@ -0,0 +1,523 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"github.com/wombatwisdom/wombat-builder/library"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"time"
+)
+
+type (
+	ProfileCreateRequest struct {
+		Name     string           `json:"name" jsonschema_description:"The name of the profile"`
+		Owner    string           `json:"owner" jsonschema_description:"The team or person owning the profile"`
+		Packages []PackageRequest `json:"packages" jsonschema_description:"The packages of the distribution. Library references are resolved when the profile is stored"`
+		Targets  []BuildTarget    `json:"targets,omitempty" jsonschema_description:"The platforms the distribution is built for by default"`
+		Changes  string           `json:"changes,omitempty" jsonschema_description:"The changelog entry of the first version"`
+	}
+
+	ProfileUpdateRequest struct {
+		Name     string           `json:"name" jsonschema_description:"The name of the profile"`
+		Owner    string           `json:"owner,omitempty" jsonschema_description:"The new owner of the profile. Defaults to the current owner"`
+		Packages []PackageRequest `json:"packages,omitempty" jsonschema_description:"The packages of the new version. Defaults to the packages of the latest version"`
+		Targets  []BuildTarget    `json:"targets,omitempty" jsonschema_description:"The default platforms of the new version. Defaults to the targets of the latest version"`
+		Changes  string           `json:"changes" jsonschema_description:"What changed in the new version"`
+	}
+
+	ProfileGetRequest struct {
+		Name    string `json:"name" jsonschema_description:"The name of the profile, optionally followed by @version"`
+		Version int    `json:"version,omitempty" jsonschema_description:"The version of the profile. Defaults to the latest version"`
+	}
+
+	ProfileResponse struct {
+		Name      string           `json:"name" jsonschema_description:"The name of the profile"`
+		Version   int              `json:"version" jsonschema_description:"The version of the profile"`
+		Owner     string           `json:"owner" jsonschema_description:"The team or person owning the profile"`
+		Packages  []model.Package  `json:"packages" jsonschema_description:"The packages of the distribution"`
+		Targets   []model.Platform `json:"targets,omitempty" jsonschema_description:"The platforms the distribution is built for by default"`
+		Changelog []ProfileChange  `json:"changelog" jsonschema_description:"The changes of every version up to this one, newest first"`
+		CreatedAt time.Time        `json:"createdAt" jsonschema_description:"When the version was created"`
+	}
+
+	ProfileChange struct {
+		Version   int       `json:"version" jsonschema_description:"The version of the profile"`
+		Owner     string    `json:"owner" jsonschema_description:"The owner at the time"`
+		Changes   string    `json:"changes,omitempty" jsonschema_description:"What changed in the version"`
+		CreatedAt time.Time `json:"createdAt" jsonschema_description:"When the version was created"`
+	}
+
+	ProfileListRequest struct{}
+
+	ProfileListResponse struct {
+		Profiles []ProfileSummary `json:"profiles" jsonschema_description:"The profiles, with their latest version"`
+	}
+
+	ProfileSummary struct {
+		Name      string    `json:"name" jsonschema_description:"The name of the profile"`
+		Version   int       `json:"version" jsonschema_description:"The latest version of the profile"`
+		Owner     string    `json:"owner" jsonschema_description:"The team or person owning the profile"`
+		CreatedAt time.Time `json:"createdAt" jsonschema_description:"When the latest version was created"`
+	}
+
+	ProfileDeleteRequest struct {
+		Name string `json:"name" jsonschema_description:"The name of the profile"`
+	}
+
+	ProfileDeleteResponse struct {
+		Name     string `json:"name" jsonschema_description:"The name of the profile"`
+		Versions int    `json:"versions" jsonschema_description:"The number of versions which were removed"`
+	}
+
+	BuildProfileRequest struct {
+		Profile    string        `json:"profile" jsonschema_description:"The profile to build, as name@version. Without a version, the latest version is built"`
+		GoVersions []string      `json:"goVersions" jsonschema_description:"The Go versions to use. Every target is built with every version"`
+		Targets    []BuildTarget `json:"targets,omitempty" jsonschema_description:"The platforms to build for. Defaults to the targets of the profile"`
+		Force      bool          `json:"force" jsonschema_description:"Whether to force a rebuild"`
+
+		Distribution *model.Distribution `json:"distribution,omitempty" jsonschema_description:"Brands the binaries with a name, version, banner and default config paths"`
+
+		Priority int `json:"priority,omitempty" jsonschema_description:"Builds with a higher priority are built first, like release builds ahead of ad-hoc requests. Ranges from -10 to 10, defaults to 0"`
+
+		// Requester is who sent the request, which is taken from the transport rather than the body.
+		Requester string `json:"-"`
+
+		MaxAttempts int                  `json:"maxAttempts,omitempty" jsonschema_description:"How many times each build may be attempted when it fails for transient reasons. Defaults to 3"`
+		Timeouts    *model.PhaseTimeouts `json:"timeouts,omitempty" jsonschema_description:"Overrides the builder timeouts of the get, tidy and build phases, expressed as durations like 10m"`
+	}
+)
+
+func (r *ProfileCreateRequest) Validate() error {
+	if err := model.ValidateProfileName(r.Name); err != nil {
+		return err
+	}
+
+	if r.Owner == "" {
+		return ErrMissingField("owner")
+	}
+
+	if len(r.Packages) == 0 {
+		return ErrMissingField("packages")
+	}
+
+	return validateProfileContent(r.Packages, r.Targets)
+}
+
+func (r *ProfileUpdateRequest) Validate() error {
+	if err := model.ValidateProfileName(r.Name); err != nil {
+		return err
+	}
+
+	if r.Changes == "" {
+		return ErrMissingField("changes")
+	}
+
+	return validateProfileContent(r.Packages, r.Targets)
+}
+
+func (r *ProfileGetRequest) Validate() error {
+	if r.Name == "" {
+		return ErrMissingField("name")
+	}
+
+	if r.Version < 0 {
+		return errors.New("version can not be negative")
+	}
+
+	return nil
+}
+
+// ref returns the version of the profile the request asks for. A version in the name takes precedence.
+func (r *ProfileGetRequest) ref() (model.ProfileRef, error) {
+	ref, err := model.ParseProfileRef(r.Name)
+	if err != nil {
+		return ref, err
+	}
+
+	if ref.Version == 0 {
+		ref.Version = r.Version
+	}
+
+	return ref, nil
+}
+
+func (r *ProfileDeleteRequest) Validate() error {
+	if r.Name == "" {
+		return ErrMissingField("name")
+	}
+
+	return nil
+}
+
+func (r *BuildProfileRequest) Validate() error {
+	if r.Profile == "" {
+		return ErrMissingField("profile")
+	}
+
+	if _, err := model.ParseProfileRef(r.Profile); err != nil {
+		return err
+	}
+
+	if len(r.GoVersions) == 0 {
+		return ErrMissingField("goVersions")
+	}
+
+	for i, t := range r.Targets {
+		if t.Goos == "" || t.Goarch == "" {
+			return fmt.Errorf("invalid target %d: both goos and goarch are required", i)
+		}
+	}
+
+	if r.MaxAttempts < 0 {
+		return errors.New("maxAttempts can not be negative")
+	}
+
+	if err := validatePriority(r.Priority); err != nil {
+		return err
+	}
+
+	if r.Distribution != nil {
+		if err := r.Distribution.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateProfileContent(packages []PackageRequest, targets []BuildTarget) error {
+	for i := range packages {
+		if err := packages[i].Validate(); err != nil {
+			return fmt.Errorf("invalid package %d: %w", i, err)
+		}
+	}
+
+	for i, t := range targets {
+		if t.Goos == "" || t.Goarch == "" {
+			return fmt.Errorf("invalid target %d: both goos and goarch are required", i)
+		}
+	}
+
+	return nil
+}
+
+// matrix turns the request into a build matrix over the packages of the profile.
+func (r *BuildProfileRequest) matrix(profile *model.Profile) BuildMatrixRequest {
+	targets := r.Targets
+	if len(targets) == 0 {
+		for _, t := range profile.Targets {
+			targets = append(targets, BuildTarget{Goos: t.Goos, Goarch: t.Goarch})
+		}
+	}
+
+	packages := make([]PackageRequest, 0, len(profile.Packages))
+	for _, p := range profile.Packages {
+		packages = append(packages, PackageRequest{Url: p.Url, Module: p.Module, Version: p.Version})
+	}
+
+	return BuildMatrixRequest{
+		GoVersions:   r.GoVersions,
+		Targets:      targets,
+		Packages:     packages,
+		Force:        r.Force,
+		Distribution: r.Distribution,
+		Priority:     r.Priority,
+		Requester:    r.Requester,
+		MaxAttempts:  r.MaxAttempts,
+		Timeouts:     r.Timeouts,
+	}
+}
+
+func getProfileCreateHandler(s *store.Store, lc library.Client) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req ProfileCreateRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+
+		if _, err := s.Profiles.Versions(context.Background(), req.Name); err == nil {
+			respondStoreError(request, "failed to create profile", fmt.Errorf("profile %s already exists: %w", req.Name, store.ErrConflict))
+			return
+		} else if !errors.Is(err, store.ErrNotFound) {
+			respondStoreError(request, "failed to create profile", err)
+			return
+		}
+
+		// -- a profile created again after being deleted does not reuse the versions it had before
+		version, err := s.Profiles.NextVersion(context.Background(), req.Name)
+		if err != nil {
+			respondStoreError(request, "failed to create profile", err)
+			return
+		}
+
+		profile := model.Profile{
+			Name:      req.Name,
+			Version:   version,
+			Owner:     req.Owner,
+			Targets:   platforms(req.Targets),
+			Changes:   req.Changes,
+			CreatedAt: time.Now().UTC(),
+		}
+
+		if profile.Packages, err = resolvePackages(lc, req.Packages); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to resolve package", []byte(err.Error()))
+			return
+		}
+
+		if err := s.Profiles.Create(context.Background(), profile); err != nil {
+			respondStoreError(request, "failed to create profile", err)
+			return
+		}
+
+		respondProfile(request, s, &profile)
+	}
+}
+
+func getProfileUpdateHandler(s *store.Store, lc library.Client) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req ProfileUpdateRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+
+		latest, err := s.Profiles.Get(context.Background(), req.Name, 0)
+		if err != nil {
+			respondStoreError(request, "failed to get profile", err)
+			return
+		}
+
+		// -- creating the next version fails when someone else created it in the meantime
+		profile := *latest
+		profile.Version = latest.Version + 1
+		profile.Changes = req.Changes
+		profile.CreatedAt = time.Now().UTC()
+		if req.Owner != "" {
+			profile.Owner = req.Owner
+		}
+		if len(req.Targets) > 0 {
+			profile.Targets = platforms(req.Targets)
+		}
+		if len(req.Packages) > 0 {
+			if profile.Packages, err = resolvePackages(lc, req.Packages); err != nil {
+				_ = request.Error("BAD_REQUEST", "failed to resolve package", []byte(err.Error()))
+				return
+			}
+		}
+
+		if err := s.Profiles.Create(context.Background(), profile); err != nil {
+			respondStoreError(request, "failed to update profile", err)
+			return
+		}
+
+		respondProfile(request, s, &profile)
+	}
+}
+
+func getProfileGetHandler(s *store.Store) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req ProfileGetRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+
+		ref, err := req.ref()
+		if err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+
+		profile, err := s.Profiles.Get(context.Background(), ref.Name, ref.Version)
+		if err != nil {
+			respondStoreError(request, "failed to get profile", err)
+			return
+		}
+
+		respondProfile(request, s, profile)
+	}
+}
+
+func getProfileListHandler(s *store.Store) micro.HandlerFunc {
+	return func(request micro.Request) {
+		names, err := s.Profiles.Names(context.Background())
+		if err != nil {
+			respondStoreError(request, "failed to list profiles", err)
+			return
+		}
+
+		result := ProfileListResponse{Profiles: []ProfileSummary{}}
+		for _, name := range names {
+			profile, err := s.Profiles.Get(context.Background(), name, 0)
+			if err != nil {
+				// -- the profile was removed while listing
+				if errors.Is(err, store.ErrNotFound) {
+					continue
+				}
+
+				respondStoreError(request, "failed to get profile", err)
+				return
+			}
+
+			result.Profiles = append(result.Profiles, ProfileSummary{
+				Name:      profile.Name,
+				Version:   profile.Version,
+				Owner:     profile.Owner,
+				CreatedAt: profile.CreatedAt,
+			})
+		}
+
+		if err := request.RespondJSON(result); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+			return
+		}
+	}
+}
+
+func getProfileDeleteHandler(s *store.Store) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req ProfileDeleteRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+
+		versions, err := s.Profiles.Versions(context.Background(), req.Name)
+		if err != nil {
+			respondStoreError(request, "failed to get profile", err)
+			return
+		}
+
+		if err := s.Profiles.Delete(context.Background(), req.Name); err != nil {
+			respondStoreError(request, "failed to delete profile", err)
+			return
+		}
+
+		if err := request.RespondJSON(ProfileDeleteResponse{Name: req.Name, Versions: len(versions)}); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+			return
+		}
+	}
+}
+
+func getBuildProfileHandler(s *store.Store, lc library.Client, q *requesters) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req BuildProfileRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+		req.Requester = q.of(request)
+
+		ref, _ := model.ParseProfileRef(req.Profile)
+		profile, err := s.Profiles.Get(context.Background(), ref.Name, ref.Version)
+		if err != nil {
+			respondStoreError(request, "failed to get profile", err)
+			return
+		}
+
+		matrix := req.matrix(profile)
+		if len(matrix.Targets) == 0 {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(fmt.Sprintf("profile %s has no default targets, so targets are required", ref)))
+			return
+		}
+
+		result, err := requestMatrix(context.Background(), s, lc, matrix)
+		if err != nil {
+			respondRequestError(request, err)
+			return
+		}
+
+		if err := request.RespondJSON(result); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+			return
+		}
+	}
+}
+
+// respondProfile responds with the profile, together with the changelog up to its version.
+func respondProfile(request micro.Request, s *store.Store, profile *model.Profile) {
+	history, err := s.Profiles.History(context.Background(), profile.Name)
+	if err != nil {
+		respondStoreError(request, "failed to get profile history", err)
+		return
+	}
+
+	result := ProfileResponse{
+		Name:      profile.Name,
+		Version:   profile.Version,
+		Owner:     profile.Owner,
+		Packages:  profile.Packages,
+		Targets:   profile.Targets,
+		Changelog: []ProfileChange{},
+		CreatedAt: profile.CreatedAt,
+	}
+
+	for i := len(history) - 1; i >= 0; i-- {
+		if v := history[i]; v.Version <= profile.Version {
+			result.Changelog = append(result.Changelog, ProfileChange{
+				Version:   v.Version,
+				Owner:     v.Owner,
+				Changes:   v.Changes,
+				CreatedAt: v.CreatedAt,
+			})
+		}
+	}
+
+	if err := request.RespondJSON(result); err != nil {
+		_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+		return
+	}
+}
+
+func resolvePackages(lc library.Client, requests []PackageRequest) ([]model.Package, error) {
+	result := make([]model.Package, 0, len(requests))
+	for i := range requests {
+		pkg, err := requests[i].resolve(lc)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, pkg)
+	}
+
+	return result, nil
+}
+
+func platforms(targets []BuildTarget) []model.Platform {
+	var result []model.Platform
+	for _, t := range targets {
+		result = append(result, model.Platform{Goos: t.Goos, Goarch: t.Goarch})
+	}
+
+	return result
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"time"
+)
+
+const (
+	// reapInterval is the time between two scans for orphaned builds.
+	reapInterval = 30 * time.Second
+
+	// maxReclaims is how often a build is handed back after its builder disappeared before it is marked as failed.
+	maxReclaims = 3
+)
+
+// runReaper periodically moves builds claimed by builders which are no longer alive back to the queue.
+func runReaper(ctx context.Context, s *store.Store) {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := reapOrphans(ctx, s); err != nil {
+				log.Error().Err(err).Msg("failed to reap orphaned builds")
+			}
+		}
+	}
+}
+
+func reapOrphans(ctx context.Context, s *store.Store) error {
+	keys, err := s.Builds.Keys(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		build, rev, err := s.Builds.GetWithRevision(ctx, key)
+		if err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				log.Warn().Err(err).Msgf("failed to get build %s", key)
+			}
+			continue
+		}
+
+		if build.Builder == "" || build.Status.IsTerminal() {
+			continue
+		}
+
+		// -- only a missing lease means the builder is gone, any other error tells us nothing about the builder
+		_, err = s.Builders.Get(ctx, build.Builder)
+		if !errors.Is(err, store.ErrNotFound) {
+			if err != nil {
+				log.Warn().Err(err).Msgf("failed to get lease of builder %s", build.Builder)
+			}
+			continue
+		}
+
+		logger := log.With().Str("build", key).Str("builder", build.Builder).Logger()
+		if build.Reclaims >= maxReclaims {
+			build.Status = model.BuildStatusFailed
+			build.Error = fmt.Sprintf("builder %s stopped responding and the build was already reclaimed %d times", build.Builder, build.Reclaims)
+			logger.Warn().Msg("giving up on orphaned build")
+		} else {
+			build.Status = model.BuildStatusNew
+			build.Reclaims++
+			logger.Info().Msg("reclaiming orphaned build")
+		}
+		build.Builder = ""
+
+		// -- a failed update means the build changed in the meantime, in which case it is no longer ours to reclaim
+		if _, err := s.Builds.Update(ctx, key, build, rev); err != nil {
+			logger.Warn().Err(err).Msg("failed to reclaim build")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/rs/zerolog/log"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"time"
+)
+
+type (
+	RepoRegisterRequest struct {
+		Name          string `json:"name" jsonschema_description:"The name of the repository"`
+		Module        string `json:"module" jsonschema_description:"The go module the repository holds"`
+		GitUrl        string `json:"gitUrl" jsonschema_description:"The url the repository is cloned from"`
+		DefaultBranch string `json:"defaultBranch,omitempty" jsonschema_description:"The default branch of the repository. Defaults to the HEAD of the mirror"`
+		Library       string `json:"library,omitempty" jsonschema_description:"The catalog library the tags are added to as versions. Defaults to the name of the repository"`
+		Mirror        string `json:"mirror,omitempty" jsonschema_description:"The path of the local bare mirror the tags are read from, relative to the mirror directory of the service. Defaults to <name>.git"`
+		TagPattern    string `json:"tagPattern,omitempty" jsonschema_description:"A glob selecting the tags to track. Defaults to v*"`
+	}
+
+	RepoRequest struct {
+		Name string `json:"name" jsonschema_description:"The name of the repository"`
+	}
+
+	RepoResponse struct {
+		model.Repo
+	}
+
+	RepoListRequest struct{}
+
+	RepoListResponse struct {
+		Repos []model.Repo `json:"repos" jsonschema_description:"The registered repositories"`
+	}
+)
+
+func (r *RepoRequest) Validate() error {
+	if r.Name == "" {
+		return ErrMissingField("name")
+	}
+
+	return nil
+}
+
+func (r *RepoRegisterRequest) repo() model.Repo {
+	return model.Repo{
+		Name:          r.Name,
+		Module:        r.Module,
+		GitUrl:        r.GitUrl,
+		DefaultBranch: r.DefaultBranch,
+		Library:       r.Library,
+		Mirror:        r.Mirror,
+		TagPattern:    r.TagPattern,
+		CreatedAt:     time.Now().UTC(),
+	}
+}
+
+func getRepoRegisterHandler(s *store.Store, syncer *repoSyncer) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req RepoRegisterRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		repo := req.repo()
+		if err := repo.Validate(); err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+
+		if err := s.Repos.Create(context.Background(), repo); err != nil {
+			respondStoreError(request, "failed to register repository", err)
+			return
+		}
+
+		// -- the first sync happens right away, so the response tells whether the mirror could be read
+		result, err := syncer.sync(context.Background(), repo.Name)
+		if err != nil {
+			// -- a registration which failed is undone, so it can be retried
+			if err := s.Repos.Delete(context.Background(), repo.Name); err != nil {
+				log.Error().Err(err).Str("repo", repo.Name).Msg("failed to remove repository after its first sync failed")
+			}
+			respondStoreError(request, "failed to sync repository", err)
+			return
+		}
+
+		if err := request.RespondJSON(RepoResponse{*result}); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+			return
+		}
+	}
+}
+
+func getRepoGetHandler(s *store.Store) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req RepoRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+
+		repo, _, err := s.Repos.Get(context.Background(), req.Name)
+		if err != nil {
+			respondStoreError(request, "failed to get repository", err)
+			return
+		}
+
+		if err := request.RespondJSON(RepoResponse{*repo}); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+			return
+		}
+	}
+}
+
+func getRepoListHandler(s *store.Store) micro.HandlerFunc {
+	return func(request micro.Request) {
+		repos, err := s.Repos.List(context.Background())
+		if err != nil {
+			respondStoreError(request, "failed to list repositories", err)
+			return
+		}
+
+		if err := request.RespondJSON(RepoListResponse{Repos: repos}); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+			return
+		}
+	}
+}
+
+func getRepoSyncHandler(syncer *repoSyncer) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req RepoRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+
+		result, err := syncer.sync(context.Background(), req.Name)
+		if err != nil {
+			respondStoreError(request, "failed to sync repository", err)
+			return
+		}
+
+		if err := request.RespondJSON(RepoResponse{*result}); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+			return
+		}
+	}
+}
+
+func getRepoDeleteHandler(s *store.Store) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req RepoRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+
+		repo, _, err := s.Repos.Get(context.Background(), req.Name)
+		if err != nil {
+			respondStoreError(request, "failed to get repository", err)
+			return
+		}
+
+		if err := s.Repos.Delete(context.Background(), req.Name); err != nil {
+			respondStoreError(request, "failed to delete repository", err)
+			return
+		}
+
+		if err := request.RespondJSON(RepoResponse{*repo}); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+			return
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"github.com/wombatwisdom/wombat-builder/library"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"golang.org/x/mod/semver"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// repoSyncer adds a library version for every tracked tag in the local mirrors of the registered repositories.
+type repoSyncer struct {
+	s  *store.Store
+	lc library.Client
+
+	// mirrorDir holds the mirrors of the repositories, which are never read from anywhere else.
+	mirrorDir string
+	interval  time.Duration
+
+	mu sync.Mutex
+}
+
+// run periodically synchronizes all repositories.
+func (y *repoSyncer) run(ctx context.Context) {
+	if y.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(y.interval)
+	defer ticker.Stop()
+
+	for {
+		y.syncAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (y *repoSyncer) syncAll(ctx context.Context) {
+	repos, err := y.s.Repos.List(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list repositories")
+		return
+	}
+
+	for _, repo := range repos {
+		result, err := y.sync(ctx, repo.Name)
+		switch {
+		case err != nil:
+			log.Error().Err(err).Str("repo", repo.Name).Msg("failed to sync repository")
+		case result.LastSync.Error != "":
+			log.Warn().Str("repo", repo.Name).Msgf("failed to sync repository: %s", result.LastSync.Error)
+		case len(result.LastSync.Added) > 0:
+			log.Info().Str("repo", repo.Name).Msgf("added versions %s", strings.Join(result.LastSync.Added, ", "))
+		}
+	}
+}
+
+// sync adds the new tags of the repository to the catalog and records the outcome with the repository.
+func (y *repoSyncer) sync(ctx context.Context, name string) (*model.Repo, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+
+	repo, rev, err := y.s.Repos.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	outcome := &model.RepoSync{At: time.Now().UTC()}
+	if outcome.Added, err = y.discover(repo); err != nil {
+		outcome.Error = err.Error()
+	}
+	repo.LastSync = outcome
+
+	if _, err := y.s.Repos.Update(ctx, repo, rev); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// discover adds the tracked tags the library does not have yet as a version, adding the library if needed.
+func (y *repoSyncer) discover(repo *model.Repo) ([]string, error) {
+	if y.mirrorDir == "" {
+		return nil, errors.New("no mirror directory is configured")
+	}
+
+	name := repo.Mirror
+	if name == "" {
+		name = repo.Name + ".git"
+	}
+
+	mirror, err := library.OpenMirror(filepath.Join(y.mirrorDir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	if repo.DefaultBranch == "" {
+		if repo.DefaultBranch, err = mirror.DefaultBranch(); err != nil {
+			return nil, err
+		}
+	}
+
+	tags, err := mirror.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	// -- only semantic versions can be used as module version, which also leaves out the tags of nested modules
+	repo.Tags = []string{}
+	for _, tag := range tags {
+		if ok, _ := path.Match(repo.TagGlob(), tag); ok && semver.IsValid(tag) {
+			repo.Tags = append(repo.Tags, tag)
+		}
+	}
+	sort.SliceStable(repo.Tags, func(i, j int) bool {
+		return semver.Compare(repo.Tags[i], repo.Tags[j]) < 0
+	})
+
+	lib := repo.LibraryName()
+	if _, err := y.lc.Library(lib); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		if err := y.lc.AddLibrary(library.Spec{Name: lib, Module: repo.Module}); err != nil {
+			return nil, fmt.Errorf("failed to add library %s: %w", lib, err)
+		}
+	}
+
+	versions, err := y.lc.Versions(lib)
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{}
+	for _, v := range versions {
+		known[v] = true
+	}
+
+	var added []string
+	for _, tag := range repo.Tags {
+		if known[tag] {
+			continue
+		}
+
+		if err := y.addVersion(lib, tag, versions); err != nil {
+			return added, fmt.Errorf("failed to add version %s: %w", tag, err)
+		}
+		versions = append(versions, tag)
+		added = append(added, tag)
+	}
+
+	return added, nil
+}
+
+// addVersion adds the tag as a version, with the bundles and packages of the closest earlier version having any.
+func (y *repoSyncer) addVersion(lib string, tag string, versions []string) error {
+	spec := library.VersionSpec{Name: tag, Bundles: []library.BundleSpec{}}
+	var packages []library.PackageSpec
+
+	earlier := make([]string, 0, len(versions))
+	for _, v := range versions {
+		if semver.IsValid(v) && semver.Compare(v, tag) < 0 {
+			earlier = append(earlier, v)
+		}
+	}
+	sort.SliceStable(earlier, func(i, j int) bool {
+		return semver.Compare(earlier[i], earlier[j]) > 0
+	})
+
+	for _, v := range earlier {
+		names, err := y.lc.Packages(lib, v)
+		if err != nil {
+			return err
+		}
+
+		if len(names) == 0 {
+			continue
+		}
+
+		prev, err := y.lc.Version(lib, v)
+		if err != nil {
+			return err
+		}
+		spec.Bundles = prev.Bundles
+
+		for _, name := range names {
+			pkg, err := y.lc.Package(lib, v, name)
+			if err != nil {
+				return err
+			}
+			packages = append(packages, *pkg)
+		}
+		break
+	}
+
+	if err := y.lc.AddVersion(lib, spec); err != nil {
+		return err
+	}
+
+	for _, pkg := range packages {
+		if err := y.lc.AddPackage(lib, tag, pkg); err != nil {
+			return fmt.Errorf("failed to add package %s: %w", pkg.Name, err)
+		}
+	}
+
+	return nil
+}
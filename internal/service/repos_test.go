@@ -0,0 +1,140 @@
+package service
+
+import (
+	"github.com/wombatwisdom/wombat-builder/library"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeMirror creates a bare repository with HEAD pointing to main and a loose ref for every tag.
+func writeMirror(t *testing.T, mirrorDir string, name string, tags ...string) {
+	t.Helper()
+
+	dir := filepath.Join(mirrorDir, name)
+	if err := os.MkdirAll(filepath.Join(dir, "refs", "tags"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "HEAD"), []byte("ref: refs/heads/main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tag := range tags {
+		p := filepath.Join(dir, "refs", "tags", filepath.FromSlash(tag))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("1111111111111111111111111111111111111111\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRepoSyncerDiscover(t *testing.T) {
+	mirrorDir := t.TempDir()
+	lc := library.NewFsClient(t.TempDir())
+	y := &repoSyncer{lc: lc, mirrorDir: mirrorDir}
+
+	writeMirror(t, mirrorDir, "acme.git", "v1.0.0", "v1.9.0", "v1.10.0", "v1.10.0-rc.1", "nested/v1.0.0", "latest")
+
+	if err := lc.AddLibrary(library.Spec{Name: "acme", Module: "github.com/acme/acme"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := lc.AddVersion("acme", library.VersionSpec{Name: "v1.0.0", Bundles: []library.BundleSpec{}}); err != nil {
+		t.Fatal(err)
+	}
+	pkg := library.PackageSpec{Name: "kafka", Fqn: "github.com/acme/acme/kafka", Inputs: []string{"acme_kafka"}}
+	if err := lc.AddPackage("acme", "v1.0.0", pkg); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &model.Repo{Name: "acme", Module: "github.com/acme/acme", GitUrl: "https://github.com/acme/acme.git"}
+	added, err := y.discover(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"v1.9.0", "v1.10.0-rc.1", "v1.10.0"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("got added %v, want %v", added, want)
+	}
+	if want := []string{"v1.0.0", "v1.9.0", "v1.10.0-rc.1", "v1.10.0"}; !reflect.DeepEqual(repo.Tags, want) {
+		t.Errorf("got tags %v, want %v", repo.Tags, want)
+	}
+	if repo.DefaultBranch != "main" {
+		t.Errorf("got default branch %q, want main", repo.DefaultBranch)
+	}
+
+	for _, v := range added {
+		got, err := lc.Package("acme", v, "kafka")
+		if err != nil {
+			t.Fatalf("package of version %s: %v", v, err)
+		}
+		if !reflect.DeepEqual(*got, pkg) {
+			t.Errorf("got package %+v for version %s, want %+v", *got, v, pkg)
+		}
+	}
+
+	// -- a second sync finds nothing new
+	added, err = y.discover(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 0 {
+		t.Errorf("expected nothing to be added on a second sync, got %v", added)
+	}
+}
+
+func TestRepoSyncerDiscoverAddsLibrary(t *testing.T) {
+	mirrorDir := t.TempDir()
+	lc := library.NewFsClient(t.TempDir())
+	y := &repoSyncer{lc: lc, mirrorDir: mirrorDir}
+
+	writeMirror(t, mirrorDir, "mirrors/acme.git", "release-1", "v1.0.0", "v2.0.0")
+
+	repo := &model.Repo{
+		Name:          "acme",
+		Module:        "github.com/acme/acme",
+		GitUrl:        "https://github.com/acme/acme.git",
+		DefaultBranch: "develop",
+		Library:       "acme-lib",
+		Mirror:        "mirrors/acme.git",
+		TagPattern:    "v2.*",
+	}
+	added, err := y.discover(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"v2.0.0"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("got added %v, want %v", added, want)
+	}
+	if repo.DefaultBranch != "develop" {
+		t.Errorf("got default branch %q, want develop to be kept", repo.DefaultBranch)
+	}
+
+	lib, err := lc.Library("acme-lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lib.Module != repo.Module {
+		t.Errorf("got module %q, want %q", lib.Module, repo.Module)
+	}
+
+	// -- without an earlier version there are no packages to copy
+	packages, err := lc.Packages("acme-lib", "v2.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packages) != 0 {
+		t.Errorf("expected no packages, got %v", packages)
+	}
+}
+
+func TestRepoSyncerDiscoverRequiresMirrorDir(t *testing.T) {
+	y := &repoSyncer{lc: library.NewFsClient(t.TempDir())}
+	if _, err := y.discover(&model.Repo{Name: "acme"}); err == nil {
+		t.Error("expected an error without a mirror directory")
+	}
+}
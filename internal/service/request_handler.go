@@ -4,18 +4,32 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/nats-io/nats.go/micro"
 	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"github.com/wombatwisdom/wombat-builder/library"
 	"github.com/wombatwisdom/wombat-builder/public/model"
 )
 
 type (
 	BuildRequestRequest struct {
-		Goos      string   `json:"goos" jsonschema_description:"The target operating system"`
-		Goarch    string   `json:"goarch" jsonschema_description:"The target architecture"`
-		GoVersion string   `json:"goVersion" jsonschema_description:"The Go version to use"`
-		Packages  []string `json:"packages" jsonschema_description:"The packages to build"`
-		Force     bool     `json:"force" jsonschema_description:"Whether to force a rebuild"`
+		Goos      string           `json:"goos" jsonschema_description:"The target operating system"`
+		Goarch    string           `json:"goarch" jsonschema_description:"The target architecture"`
+		GoVersion string           `json:"goVersion" jsonschema_description:"The Go version to use"`
+		Packages  []PackageRequest `json:"packages" jsonschema_description:"The packages to build. Either import paths, optionally pinned to a module version, or references into the library catalog"`
+		Force     bool             `json:"force" jsonschema_description:"Whether to force a rebuild"`
+		Cgo       bool             `json:"cgo,omitempty" jsonschema_description:"Whether to build with cgo enabled. Only builders with a C compiler for the target take up the build"`
+		Plugin    bool             `json:"plugin,omitempty" jsonschema_description:"Whether to build a go plugin instead of an executable. Only builders running on the target platform take up the build"`
+
+		Distribution *model.Distribution `json:"distribution,omitempty" jsonschema_description:"Brands the binary with a name, version, banner and default config paths"`
+
+		Priority int `json:"priority,omitempty" jsonschema_description:"Builds with a higher priority are built first, like release builds ahead of ad-hoc requests. Ranges from -10 to 10, defaults to 0"`
+
+		// Requester is who sent the request, which is taken from the transport rather than the body.
+		Requester string `json:"-"`
+
+		MaxAttempts int                  `json:"maxAttempts,omitempty" jsonschema_description:"How many times the build may be attempted when it fails for transient reasons. Defaults to 3"`
+		Timeouts    *model.PhaseTimeouts `json:"timeouts,omitempty" jsonschema_description:"Overrides the builder timeouts of the get, tidy and build phases, expressed as durations like 10m"`
 	}
 
 	BuildRequestResponse struct {
@@ -41,14 +55,46 @@ func (r *BuildRequestRequest) Validate() error {
 		return ErrMissingField("packages")
 	}
 
+	for i := range r.Packages {
+		if err := r.Packages[i].Validate(); err != nil {
+			return fmt.Errorf("invalid package %d: %w", i, err)
+		}
+	}
+
+	if r.MaxAttempts < 0 {
+		return errors.New("maxAttempts can not be negative")
+	}
+
+	if err := validatePriority(r.Priority); err != nil {
+		return err
+	}
+
+	if r.Distribution != nil {
+		if err := r.Distribution.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validatePriority makes sure the priority stays within the bounds.
+func validatePriority(priority int) error {
+	if priority < model.MinPriority || priority > model.MaxPriority {
+		return fmt.Errorf("priority must be between %d and %d", model.MinPriority, model.MaxPriority)
+	}
+
 	return nil
 }
 
+// defaultMaxAttempts is the retry budget of builds which were requested without one.
+const defaultMaxAttempts = 3
+
 func ErrMissingField(s string) error {
 	return errors.New("missing required field " + s)
 }
 
-func getBuildRequestHandler(s *store.Store) micro.HandlerFunc {
+func getBuildRequestHandler(s *store.Store, lc library.Client, q *requesters) micro.HandlerFunc {
 	return func(request micro.Request) {
 		var req BuildRequestRequest
 		if err := json.Unmarshal(request.Data(), &req); err != nil {
@@ -60,51 +106,70 @@ func getBuildRequestHandler(s *store.Store) micro.HandlerFunc {
 			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
 			return
 		}
+		req.Requester = q.of(request)
 
-		// -- create a build out of the request
-		build, err := model.NewBuild(
-			model.WithGoVersion(req.GoVersion),
-			model.WithGoos(req.Goos),
-			model.WithGoarch(req.Goarch),
-			model.WithPackageUrls(req.Packages...),
-		)
+		result, err := requestBuild(context.Background(), s, lc, req)
 		if err != nil {
-			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			respondRequestError(request, err)
 			return
 		}
 
-		// -- check if the build already exists
-		existing, err := s.Builds.Get(context.Background(), build.Id())
-		if err != nil {
-			_ = request.Error("BACKBONE_ERROR", "failed to check if build exists", []byte(err.Error()))
+		if err := request.RespondJSON(result); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
 			return
 		}
+	}
+}
 
-		if !req.Force && existing != nil {
-			result := BuildRequestResponse{
-				Id:     existing.Id(),
-				Status: existing.Status,
-			}
-			if err := request.RespondJSON(result); err != nil {
-				_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
-				return
-			}
-		} else {
-			// -- store the build
-			_, err := s.Builds.Set(context.Background(), build)
-			if err != nil {
-				_ = request.Error("BACKBONE_ERROR", "failed to store build", []byte(err.Error()))
-				return
-			}
-
-			result := BuildRequestResponse{
-				Id:     build.Id(),
-				Status: build.Status,
-			}
-			if err := request.RespondJSON(result); err != nil {
-				_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
-				return
-			}
-		}
+// requestBuild creates the build unless it exists and no rebuild is forced. Request errors are badRequestErrors.
+func requestBuild(ctx context.Context, s *store.Store, lc library.Client, req BuildRequestRequest) (BuildRequestResponse, error) {
+	if req.MaxAttempts == 0 {
+		req.MaxAttempts = defaultMaxAttempts
+	}
+
+	opts := []model.BuildOpt{
+		model.WithGoVersion(req.GoVersion),
+		model.WithGoos(req.Goos),
+		model.WithGoarch(req.Goarch),
+		model.WithMaxAttempts(req.MaxAttempts),
+		model.WithTimeouts(req.Timeouts),
+		model.WithConstraints(model.BuildConstraints{Cgo: req.Cgo, Plugin: req.Plugin}),
+		model.WithDistribution(req.Distribution),
+		model.WithPriority(req.Priority),
+		model.WithRequester(req.Requester),
+	}
+
+	packages, err := resolvePackages(lc, req.Packages)
+	if err != nil {
+		return BuildRequestResponse{}, badRequestError{description: "failed to resolve package", err: err}
+	}
+
+	access, err := moduleAccess(lc, packages)
+	if err != nil {
+		return BuildRequestResponse{}, fmt.Errorf("failed to look up the access to private modules: %w", err)
+	}
+	opts = append(opts, model.WithPackage(packages...), model.WithAccess(access))
+
+	// -- create a build out of the request
+	build, err := model.NewBuild(opts...)
+	if err != nil {
+		return BuildRequestResponse{}, badRequestError{description: "invalid request", err: err}
+	}
+
+	// -- check if the build already exists
+	existing, err := s.Builds.Get(ctx, build.Id())
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return BuildRequestResponse{}, fmt.Errorf("failed to check if build exists: %w", err)
 	}
+
+	if !req.Force && existing != nil {
+		return BuildRequestResponse{Id: existing.Id(), Status: existing.Status}, nil
+	}
+
+	// -- store the build
+	if _, err := s.Builds.Set(ctx, build); err != nil {
+		return BuildRequestResponse{}, fmt.Errorf("failed to store build: %w", err)
+	}
+
+	return BuildRequestResponse{Id: build.Id(), Status: build.Status}, nil
 }
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/wombatwisdom/wombat-builder/internal/shared"
+	"strings"
+)
+
+// requestInfoHeader describes the client of a request coming in from another account.
+const requestInfoHeader = "Nats-Request-Info"
+
+// requesters identifies who sent a request, so the builders can share their workers fairly between requesters.
+type requesters struct {
+	// inbox is the reply prefix of our own connection, which the api shares when running in the same process
+	inbox string
+
+	// apiUsers are the clients, as account/user, the api connects with from another account
+	apiUsers map[string]bool
+}
+
+func newRequesters(nc *nats.Conn, apiUsers []string) *requesters {
+	q := &requesters{apiUsers: map[string]bool{}}
+	if nc != nil {
+		q.inbox = replyPrefix(nc.NewRespInbox())
+	}
+
+	for _, u := range apiUsers {
+		q.apiUsers[u] = true
+	}
+
+	return q
+}
+
+// of returns who sent the request, only trusting the requester header on requests from the api.
+func (q *requesters) of(request micro.Request) string {
+	client, fromApi := q.clientOf(request)
+	if fromApi {
+		if requester := request.Headers().Get(shared.RequesterHeader); requester != "" {
+			return requester
+		}
+	}
+
+	return client
+}
+
+// clientOf identifies the client which sent the request and tells whether it is the api.
+func (q *requesters) clientOf(request micro.Request) (string, bool) {
+	if info := request.Headers().Get(requestInfoHeader); info != "" {
+		var client struct {
+			Account string `json:"acc"`
+			User    string `json:"user"`
+		}
+		if err := json.Unmarshal([]byte(info), &client); err == nil && client.Account != "" {
+			id := client.Account
+			if client.User != "" {
+				id += "/" + client.User
+			}
+
+			return id, q.apiUsers[id]
+		}
+	}
+
+	inbox := replyPrefix(request.Reply())
+	return inbox, q.inbox != "" && inbox == q.inbox
+}
+
+// replyPrefix strips the token identifying the request from a reply subject, leaving the inbox of the connection.
+func replyPrefix(reply string) string {
+	if i := strings.LastIndexByte(reply, '.'); i > 0 {
+		return reply[:i]
+	}
+
+	return reply
+}
@@ -7,18 +7,61 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/wombatwisdom/wombat-builder/internal/shared"
 	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"github.com/wombatwisdom/wombat-builder/library"
+	"time"
 )
 
-func NewService(nc *nats.Conn, s *store.Store) (*Service, error) {
-	return &Service{
-		nc: nc,
-		s:  s,
-	}, nil
+type ServiceOpt func(*Service)
+
+// WithRetention sets the policy the garbage collection uses to decide which builds to remove.
+func WithRetention(policy RetentionPolicy) ServiceOpt {
+	return func(s *Service) {
+		s.gc.policy = policy
+	}
+}
+
+// WithApiUsers sets the account/user clients of the api, which may name the requester they send requests for.
+func WithApiUsers(users ...string) ServiceOpt {
+	return func(s *Service) {
+		s.apiUsers = users
+	}
+}
+
+// WithRepoSync synchronizes the registered repositories with the catalog, reading them from their mirrors in mirrorDir.
+func WithRepoSync(mirrorDir string, interval time.Duration) ServiceOpt {
+	return func(s *Service) {
+		s.repos.mirrorDir = mirrorDir
+		s.repos.interval = interval
+	}
+}
+
+func NewService(nc *nats.Conn, s *store.Store, lc library.Client, opts ...ServiceOpt) (*Service, error) {
+	svc := &Service{
+		nc:    nc,
+		s:     s,
+		lc:    lc,
+		gc:    &collector{s: s},
+		repos: &repoSyncer{s: s, lc: lc},
+	}
+
+	for _, opt := range opts {
+		opt(svc)
+	}
+	svc.requesters = newRequesters(nc, svc.apiUsers)
+
+	return svc, nil
 }
 
 type Service struct {
 	nc *nats.Conn
 	s  *store.Store
+	lc library.Client
+	gc *collector
+
+	apiUsers   []string
+	requesters *requesters
+
+	repos *repoSyncer
 }
 
 func (s *Service) Run(ctx context.Context) error {
@@ -40,18 +83,159 @@ func (s *Service) Run(ctx context.Context) error {
 	}
 
 	buildGrp := svc.AddGroup("build")
-	registerEndpointOrDie(buildGrp, "request", getBuildRequestHandler(s.s), micro.WithEndpointMetadata(map[string]string{
+	registerEndpointOrDie(buildGrp, "request", getBuildRequestHandler(s.s, s.lc, s.requesters), micro.WithEndpointMetadata(map[string]string{
 		"description":     "Request a build",
 		"request-schema":  shared.SchemaForOrDie(&BuildRequestRequest{}),
 		"response-schema": shared.SchemaForOrDie(&BuildRequestResponse{}),
 	}))
 
+	registerEndpointOrDie(buildGrp, "matrix", getBuildMatrixHandler(s.s, s.lc, s.requesters), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Request a build for every combination of targets and Go versions, grouped together",
+		"request-schema":  shared.SchemaForOrDie(&BuildMatrixRequest{}),
+		"response-schema": shared.SchemaForOrDie(&BuildMatrixResponse{}),
+	}))
+
+	registerEndpointOrDie(buildGrp, "group", getBuildGroupHandler(s.s), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Get the status of a group of builds, aggregated over its builds",
+		"request-schema":  shared.SchemaForOrDie(&BuildGroupRequest{}),
+		"response-schema": shared.SchemaForOrDie(&BuildGroupResponse{}),
+	}))
+
 	registerEndpointOrDie(buildGrp, "list", getBuildListHandler(s.s), micro.WithEndpointMetadata(map[string]string{
 		"description":     "List builds",
 		"request-schema":  shared.SchemaForOrDie(&BuildListRequest{}),
 		"response-schema": shared.SchemaForOrDie(&BuildListResponse{}),
 	}))
 
+	registerEndpointOrDie(buildGrp, "get", getBuildGetHandler(s.s), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Get a build, including the progress of its phases",
+		"request-schema":  shared.SchemaForOrDie(&BuildGetRequest{}),
+		"response-schema": shared.SchemaForOrDie(&BuildGetResponse{}),
+	}))
+
+	registerEndpointOrDie(buildGrp, "watch", getBuildWatchHandler(s.nc, s.s), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Stream the changes of a build until it finishes. The stream ends with an empty message",
+		"request-schema":  shared.SchemaForOrDie(&BuildWatchRequest{}),
+		"response-schema": shared.SchemaForOrDie(&BuildWatchEvent{}),
+	}))
+
+	registerEndpointOrDie(buildGrp, "cancel", getBuildCancelHandler(s.s), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Cancel a build which has not finished yet",
+		"request-schema":  shared.SchemaForOrDie(&BuildCancelRequest{}),
+		"response-schema": shared.SchemaForOrDie(&BuildCancelResponse{}),
+	}))
+
+	registerEndpointOrDie(buildGrp, "logs", getBuildLogsHandler(s.s), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Get the toolchain output of a build",
+		"request-schema":  shared.SchemaForOrDie(&BuildLogsRequest{}),
+		"response-schema": shared.SchemaForOrDie(&BuildLogsResponse{}),
+	}))
+
+	registerEndpointOrDie(buildGrp, "modules", getBuildModulesHandler(s.s), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Get the go.mod, go.sum and module list a build was resolved to",
+		"request-schema":  shared.SchemaForOrDie(&BuildModulesRequest{}),
+		"response-schema": shared.SchemaForOrDie(&BuildModulesResponse{}),
+	}))
+
+	registerEndpointOrDie(buildGrp, "pin", getBuildPinHandler(s.s), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Pin a build, so it is never removed by the garbage collection, or unpin it again",
+		"request-schema":  shared.SchemaForOrDie(&BuildPinRequest{}),
+		"response-schema": shared.SchemaForOrDie(&BuildPinResponse{}),
+	}))
+
+	registerEndpointOrDie(buildGrp, "profile", getBuildProfileHandler(s.s, s.lc, s.requesters), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Build a version of a distribution profile for its default targets, grouped together",
+		"request-schema":  shared.SchemaForOrDie(&BuildProfileRequest{}),
+		"response-schema": shared.SchemaForOrDie(&BuildMatrixResponse{}),
+	}))
+
+	profileGrp := svc.AddGroup("profiles")
+	registerEndpointOrDie(profileGrp, "create", getProfileCreateHandler(s.s, s.lc), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Create a distribution profile",
+		"request-schema":  shared.SchemaForOrDie(&ProfileCreateRequest{}),
+		"response-schema": shared.SchemaForOrDie(&ProfileResponse{}),
+	}))
+
+	registerEndpointOrDie(profileGrp, "update", getProfileUpdateHandler(s.s, s.lc), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Create the next version of a distribution profile",
+		"request-schema":  shared.SchemaForOrDie(&ProfileUpdateRequest{}),
+		"response-schema": shared.SchemaForOrDie(&ProfileResponse{}),
+	}))
+
+	registerEndpointOrDie(profileGrp, "get", getProfileGetHandler(s.s), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Get a version of a distribution profile, including its changelog",
+		"request-schema":  shared.SchemaForOrDie(&ProfileGetRequest{}),
+		"response-schema": shared.SchemaForOrDie(&ProfileResponse{}),
+	}))
+
+	registerEndpointOrDie(profileGrp, "list", getProfileListHandler(s.s), micro.WithEndpointMetadata(map[string]string{
+		"description":     "List the distribution profiles",
+		"request-schema":  shared.SchemaForOrDie(&ProfileListRequest{}),
+		"response-schema": shared.SchemaForOrDie(&ProfileListResponse{}),
+	}))
+
+	registerEndpointOrDie(profileGrp, "delete", getProfileDeleteHandler(s.s), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Delete a distribution profile with all of its versions",
+		"request-schema":  shared.SchemaForOrDie(&ProfileDeleteRequest{}),
+		"response-schema": shared.SchemaForOrDie(&ProfileDeleteResponse{}),
+	}))
+
+	repoGrp := svc.AddGroup("repos")
+	registerEndpointOrDie(repoGrp, "register", getRepoRegisterHandler(s.s, s.repos), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Register a component repository and add its tags to the catalog",
+		"request-schema":  shared.SchemaForOrDie(&RepoRegisterRequest{}),
+		"response-schema": shared.SchemaForOrDie(&RepoResponse{}),
+	}))
+
+	registerEndpointOrDie(repoGrp, "get", getRepoGetHandler(s.s), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Get a component repository, including the outcome of its last sync",
+		"request-schema":  shared.SchemaForOrDie(&RepoRequest{}),
+		"response-schema": shared.SchemaForOrDie(&RepoResponse{}),
+	}))
+
+	registerEndpointOrDie(repoGrp, "list", getRepoListHandler(s.s), micro.WithEndpointMetadata(map[string]string{
+		"description":     "List the component repositories",
+		"request-schema":  shared.SchemaForOrDie(&RepoListRequest{}),
+		"response-schema": shared.SchemaForOrDie(&RepoListResponse{}),
+	}))
+
+	registerEndpointOrDie(repoGrp, "sync", getRepoSyncHandler(s.repos), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Add the new tags of a component repository to the catalog right away",
+		"request-schema":  shared.SchemaForOrDie(&RepoRequest{}),
+		"response-schema": shared.SchemaForOrDie(&RepoResponse{}),
+	}))
+
+	registerEndpointOrDie(repoGrp, "delete", getRepoDeleteHandler(s.s), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Unregister a component repository. The versions it added to the catalog are kept",
+		"request-schema":  shared.SchemaForOrDie(&RepoRequest{}),
+		"response-schema": shared.SchemaForOrDie(&RepoResponse{}),
+	}))
+
+	builderGrp := svc.AddGroup("builders")
+	registerEndpointOrDie(builderGrp, "list", getBuilderListHandler(s.s), micro.WithEndpointMetadata(map[string]string{
+		"description":     "List the builders which are alive, together with the builds they are working on",
+		"request-schema":  shared.SchemaForOrDie(&BuilderListRequest{}),
+		"response-schema": shared.SchemaForOrDie(&BuilderListResponse{}),
+	}))
+
+	registerEndpointOrDie(svc, "stats", getStatsHandler(s.s), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Get the most downloaded builds and package combinations",
+		"request-schema":  shared.SchemaForOrDie(&StatsRequest{}),
+		"response-schema": shared.SchemaForOrDie(&StatsResponse{}),
+	}))
+
+	maintenanceGrp := svc.AddGroup("maintenance")
+	registerEndpointOrDie(maintenanceGrp, "gc", getGcHandler(s.gc), micro.WithEndpointMetadata(map[string]string{
+		"description":     "Remove the builds the retention policy no longer keeps, or report what would be removed in dry-run mode",
+		"request-schema":  shared.SchemaForOrDie(&GcRequest{}),
+		"response-schema": shared.SchemaForOrDie(&GcReport{}),
+	}))
+
+	go runReaper(ctx, s.s)
+	go s.gc.run(ctx)
+	go runStatsAggregator(ctx, s.s)
+	go s.repos.run(ctx)
+
 	log.Info().Msgf("service started: %v", svc.Info().ID)
 
 	// -- wait for the context to complete
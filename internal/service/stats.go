@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/rs/zerolog/log"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"sort"
+	"time"
+)
+
+// aggregateRetryDelay is the time to wait before consuming the download events again after a failure.
+const aggregateRetryDelay = 10 * time.Second
+
+// runStatsAggregator turns the download events into per build counters.
+func runStatsAggregator(ctx context.Context, s *store.Store) {
+	for {
+		err := s.Downloads.Consume(ctx, func(event model.DownloadEvent) error {
+			return aggregateDownload(ctx, s, event)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Error().Err(err).Msg("failed to consume download events")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(aggregateRetryDelay):
+		}
+	}
+}
+
+func aggregateDownload(ctx context.Context, s *store.Store, event model.DownloadEvent) error {
+	// -- the statistics of a build are removed along with it, so downloads of removed builds are not recorded
+	build, err := s.Builds.Get(ctx, event.BuildId)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.Stats.Update(ctx, event.BuildId, func(stats *model.DownloadStats) error {
+		// -- the packages are copied from the build on the first download
+		if stats.BuildId == "" {
+			stats.BuildId = event.BuildId
+			stats.Goos = build.Goos
+			stats.Goarch = build.Goarch
+			stats.Packages = packageUrls(build)
+		}
+
+		stats.Add(event)
+		return nil
+	})
+}
+
+// PackageSetStats aggregates the downloads of all builds of the same packages, regardless of the platform.
+type PackageSetStats struct {
+	Packages  []string `json:"packages" jsonschema_description:"The import paths of the packages"`
+	Builds    int      `json:"builds" jsonschema_description:"The number of builds of the packages which were downloaded"`
+	Downloads int64    `json:"downloads" jsonschema_description:"The number of downloads"`
+	Bytes     int64    `json:"bytes" jsonschema_description:"The number of bytes served"`
+}
+
+// topPackageSets groups the statistics by package set and returns the most downloaded ones.
+func topPackageSets(stats []model.DownloadStats, limit int) []PackageSetStats {
+	sets := map[string]*PackageSetStats{}
+	for _, st := range stats {
+		if len(st.Packages) == 0 {
+			continue
+		}
+
+		key := joinUrls(st.Packages)
+		set, fnd := sets[key]
+		if !fnd {
+			set = &PackageSetStats{Packages: st.Packages}
+			sets[key] = set
+		}
+
+		set.Builds++
+		set.Downloads += st.Downloads
+		set.Bytes += st.Bytes
+	}
+
+	result := make([]PackageSetStats, 0, len(sets))
+	for _, set := range sets {
+		result = append(result, *set)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Downloads > result[j].Downloads
+	})
+
+	return result[:min(limit, len(result))]
+}
+
+// topBuilds returns the most downloaded builds.
+func topBuilds(stats []model.DownloadStats, limit int) []model.DownloadStats {
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Downloads > stats[j].Downloads
+	})
+
+	return stats[:min(limit, len(stats))]
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+)
+
+// defaultStatsLimit is the number of entries returned when the request does not specify a limit.
+const defaultStatsLimit = 10
+
+type (
+	StatsRequest struct {
+		Limit int `json:"limit,omitempty" jsonschema_description:"The number of entries to return. Defaults to 10"`
+	}
+
+	StatsResponse struct {
+		Packages []PackageSetStats     `json:"packages" jsonschema_description:"The most downloaded package combinations"`
+		Builds   []model.DownloadStats `json:"builds" jsonschema_description:"The most downloaded builds"`
+	}
+)
+
+func (r *StatsRequest) Validate() error {
+	if r.Limit < 0 {
+		return errors.New("limit can not be negative")
+	}
+
+	return nil
+}
+
+func getStatsHandler(s *store.Store) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req StatsRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+
+		if req.Limit == 0 {
+			req.Limit = defaultStatsLimit
+		}
+
+		stats, err := s.Stats.List(context.Background())
+		if err != nil {
+			respondStoreError(request, "failed to list statistics", err)
+			return
+		}
+
+		result := StatsResponse{
+			Packages: topPackageSets(stats, req.Limit),
+			Builds:   topBuilds(stats, req.Limit),
+		}
+		if err := request.RespondJSON(result); err != nil {
+			_ = request.Error("INTERNAL_ERROR", "failed to respond", []byte(err.Error()))
+			return
+		}
+	}
+}
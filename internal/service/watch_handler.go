@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/rs/zerolog/log"
+	"github.com/wombatwisdom/wombat-builder/internal/shared"
+	"github.com/wombatwisdom/wombat-builder/internal/store"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"time"
+)
+
+// watchMaxDuration caps how long a single watch request streams updates.
+const watchMaxDuration = time.Hour
+
+// An idle watch sends a heartbeat every watchHeartbeatInterval and stops without an answer in watchHeartbeatTimeout.
+const (
+	watchHeartbeatInterval = 30 * time.Second
+	watchHeartbeatTimeout  = 10 * time.Second
+)
+
+type (
+	BuildWatchRequest struct {
+		Id string `json:"id" jsonschema_description:"The ID of the build to watch"`
+	}
+
+	BuildWatchEvent struct {
+		Id       string      `json:"id" jsonschema_description:"The ID of the build"`
+		Revision uint64      `json:"revision" jsonschema_description:"The revision of the build in the store"`
+		Build    model.Build `json:"build" jsonschema_description:"The build as it was at this revision"`
+	}
+)
+
+func (r *BuildWatchRequest) Validate() error {
+	if r.Id == "" {
+		return ErrMissingField("id")
+	}
+
+	return nil
+}
+
+// getBuildWatchHandler streams the build and every change to it in the background, until its status is terminal.
+func getBuildWatchHandler(nc *nats.Conn, s *store.Store) micro.HandlerFunc {
+	return func(request micro.Request) {
+		var req BuildWatchRequest
+		if err := json.Unmarshal(request.Data(), &req); err != nil {
+			_ = request.Error("BAD_REQUEST", "failed to parse request", []byte(err.Error()))
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			_ = request.Error("BAD_REQUEST", "invalid request", []byte(err.Error()))
+			return
+		}
+
+		if _, err := s.Builds.Get(context.Background(), req.Id); err != nil {
+			respondStoreError(request, "failed to get build", err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), watchMaxDuration)
+		kw, err := s.Builds.Follow(ctx, req.Id)
+		if err != nil {
+			cancel()
+			respondStoreError(request, "failed to watch build", err)
+			return
+		}
+
+		go func() {
+			defer cancel()
+			defer kw.Stop()
+
+			streamBuildUpdates(ctx, nc, request, req.Id, kw)
+
+			// -- mark the end of the stream
+			_ = request.Respond(nil)
+		}()
+	}
+}
+
+func streamBuildUpdates(ctx context.Context, nc *nats.Conn, request micro.Request, id string, kw jetstream.KeyWatcher) {
+	heartbeat := time.NewTicker(watchHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if err := sendHeartbeat(nc, request.Reply()); err != nil {
+				log.Debug().Err(err).Msgf("stopped watching build %s, the client is gone", id)
+				return
+			}
+		case update, ok := <-kw.Updates():
+			if !ok {
+				return
+			}
+
+			if update == nil {
+				continue
+			}
+
+			if update.Operation() != jetstream.KeyValuePut {
+				return
+			}
+
+			var build model.Build
+			if err := json.Unmarshal(update.Value(), &build); err != nil {
+				log.Warn().Err(err).Msgf("failed to unmarshal build %s", id)
+				continue
+			}
+
+			evt := BuildWatchEvent{Id: id, Revision: update.Revision(), Build: build}
+			if err := request.RespondJSON(evt); err != nil {
+				log.Warn().Err(err).Msgf("failed to send update of build %s", id)
+				return
+			}
+
+			if build.Status.IsTerminal() {
+				return
+			}
+			heartbeat.Reset(watchHeartbeatInterval)
+		}
+	}
+}
+
+// sendHeartbeat asks the client listening on the reply subject whether it is still there.
+func sendHeartbeat(nc *nats.Conn, reply string) error {
+	msg := nats.NewMsg(reply)
+	msg.Header.Set(shared.HeartbeatHeader, "1")
+
+	_, err := nc.RequestMsg(msg, watchHeartbeatTimeout)
+	return err
+}
@@ -0,0 +1,9 @@
+package shared
+
+const (
+	// HeartbeatHeader marks a message of a stream as a heartbeat request, which an interested client answers.
+	HeartbeatHeader = "Wombat-Heartbeat"
+
+	// RequesterHeader identifies who sent a request, like the http client the api forwards it for.
+	RequesterHeader = "Wombat-Requester"
+)
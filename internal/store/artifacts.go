@@ -2,16 +2,71 @@ package store
 
 import (
   "context"
+  "errors"
+  "fmt"
   "github.com/nats-io/nats.go/jetstream"
+  "github.com/wombatwisdom/wombat-builder/signing"
   "io"
   "os"
+  "time"
+)
+
+const (
+  // Sha256Suffix and SignatureSuffix are appended to the name of an artifact to get the name of its companions.
+  Sha256Suffix    = ".sha256"
+  SignatureSuffix = ".sig"
+
+  // GzipSuffix and ZstdSuffix are appended to the name of an artifact to get the name of its compressed copies.
+  GzipSuffix = ".gz"
+  ZstdSuffix = ".zst"
+
+  // TarGzSuffix and ZipSuffix are appended to the name of an artifact to get the name of the archive bundling it.
+  TarGzSuffix = ".tar.gz"
+  ZipSuffix   = ".zip"
+)
+
+const (
+  // lastDownloadMetadata is the object metadata holding the last time an object was downloaded.
+  lastDownloadMetadata = "last-download"
+
+  // downloadResolution limits how often the last download time of an object is updated.
+  downloadResolution = time.Hour
 )
 
 type Artifacts struct {
   obj jetstream.ObjectStore
 }
 
-func (a *Artifacts) WriteFile(ctx context.Context, name string, path string) (*jetstream.ObjectInfo, error) {
+type (
+  WriteOpt func(*writeOptions)
+
+  writeOptions struct {
+    companions bool
+    signer     *signing.Signer
+  }
+)
+
+// WithCompanions stores the SHA-256 digest of the file next to it, as well as its signature when a signer is given.
+func WithCompanions(signer *signing.Signer) WriteOpt {
+  return func(o *writeOptions) {
+    o.companions = true
+    o.signer = signer
+  }
+}
+
+func (a *Artifacts) WriteFile(ctx context.Context, name string, path string, opts ...WriteOpt) (*jetstream.ObjectInfo, error) {
+  var o writeOptions
+  for _, opt := range opts {
+    opt(&o)
+  }
+
+  // -- the companions are written first, so the artifact never exists without them
+  if o.companions {
+    if err := a.writeCompanions(ctx, name, path, o.signer); err != nil {
+      return nil, err
+    }
+  }
+
   reader, err := os.Open(path)
   if err != nil {
     return nil, err
@@ -22,9 +77,108 @@ func (a *Artifacts) WriteFile(ctx context.Context, name string, path string) (*j
     Name: name,
   }
 
-  return a.obj.Put(ctx, om, reader)
+  oi, err := a.obj.Put(ctx, om, reader)
+  return oi, translateError(err)
+}
+
+func (a *Artifacts) writeCompanions(ctx context.Context, name string, path string, signer *signing.Signer) error {
+  digest, err := withFile(path, signing.Sha256)
+  if err != nil {
+    return fmt.Errorf("failed to compute digest: %w", err)
+  }
+
+  if _, err := a.obj.PutString(ctx, name+Sha256Suffix, digest); err != nil {
+    return translateError(err)
+  }
+
+  if signer == nil {
+    return nil
+  }
+
+  sig, err := withFile(path, func(r io.Reader) ([]byte, error) {
+    return signer.Sign(r, name)
+  })
+  if err != nil {
+    return fmt.Errorf("failed to sign: %w", err)
+  }
+
+  if _, err := a.obj.PutBytes(ctx, name+SignatureSuffix, sig); err != nil {
+    return translateError(err)
+  }
+
+  return nil
 }
 
 func (a *Artifacts) Read(ctx context.Context, name string) (io.ReadCloser, error) {
-  return a.obj.Get(ctx, name)
+  or, err := a.obj.Get(ctx, name)
+  return or, translateError(err)
+}
+
+// Info returns the information of the object with the given name.
+func (a *Artifacts) Info(ctx context.Context, name string) (*jetstream.ObjectInfo, error) {
+  oi, err := a.obj.GetInfo(ctx, name)
+  return oi, translateError(err)
+}
+
+// List returns the information of all objects in the store.
+func (a *Artifacts) List(ctx context.Context) ([]*jetstream.ObjectInfo, error) {
+  objects, err := a.obj.List(ctx)
+  if err != nil {
+    if errors.Is(err, jetstream.ErrNoObjectsFound) {
+      return []*jetstream.ObjectInfo{}, nil
+    }
+
+    return nil, translateError(err)
+  }
+
+  return objects, nil
+}
+
+// Delete removes the object with the given name. Removing an object which does not exist is not an error.
+func (a *Artifacts) Delete(ctx context.Context, name string) error {
+  err := a.obj.Delete(ctx, name)
+  if err != nil && !errors.Is(err, jetstream.ErrObjectNotFound) {
+    return translateError(err)
+  }
+
+  return nil
+}
+
+// LastDownload returns the last time the object was downloaded, or the zero time if it never was.
+func LastDownload(oi *jetstream.ObjectInfo) time.Time {
+  t, err := time.Parse(time.RFC3339, oi.Metadata[lastDownloadMetadata])
+  if err != nil {
+    return time.Time{}
+  }
+
+  return t
+}
+
+// MarkDownloaded records the download time on the object, at most once an hour to keep the writes down.
+func MarkDownloaded(ctx context.Context, obj jetstream.ObjectStore, oi *jetstream.ObjectInfo) error {
+  now := time.Now().UTC()
+  if now.Sub(LastDownload(oi)) < downloadResolution {
+    return nil
+  }
+
+  meta := oi.ObjectMeta
+  metadata := map[string]string{}
+  for k, v := range meta.Metadata {
+    metadata[k] = v
+  }
+  metadata[lastDownloadMetadata] = now.Format(time.RFC3339)
+  meta.Metadata = metadata
+
+  return translateError(obj.UpdateMeta(ctx, oi.Name, meta))
+}
+
+func withFile[T any](path string, fn func(r io.Reader) (T, error)) (T, error) {
+  f, err := os.Open(path)
+  if err != nil {
+    var zero T
+    return zero, err
+  }
+  defer f.Close()
+
+  return fn(f)
 }
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog/log"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+)
+
+// Builders keeps track of the builders which are alive, using a bucket with a TTL to expire their leases.
+type Builders struct {
+	kv jetstream.KeyValue
+}
+
+func (b *Builders) Heartbeat(ctx context.Context, lease *model.BuilderLease) error {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.kv.Put(ctx, lease.Id, data)
+	return translateError(err)
+}
+
+func (b *Builders) Remove(ctx context.Context, id string) error {
+	return translateError(b.kv.Delete(ctx, id))
+}
+
+// Get returns the lease of the builder. If the builder is not alive, ErrNotFound is returned.
+func (b *Builders) Get(ctx context.Context, id string) (*model.BuilderLease, error) {
+	entry, err := b.kv.Get(ctx, id)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	var lease model.BuilderLease
+	if err := json.Unmarshal(entry.Value(), &lease); err != nil {
+		return nil, err
+	}
+
+	return &lease, nil
+}
+
+func (b *Builders) List(ctx context.Context) ([]model.BuilderLease, error) {
+	keys, err := b.kv.Keys(ctx)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrNoKeysFound) {
+			return []model.BuilderLease{}, nil
+		}
+
+		return nil, translateError(err)
+	}
+
+	result := make([]model.BuilderLease, 0, len(keys))
+	for _, key := range keys {
+		lease, err := b.Get(ctx, key)
+		if err != nil {
+			// -- the lease may have expired in between listing and getting it
+			if !errors.Is(err, ErrNotFound) {
+				log.Warn().Err(err).Msgf("failed to get builder %s", key)
+			}
+			continue
+		}
+
+		result = append(result, *lease)
+	}
+
+	return result, nil
+}
@@ -6,41 +6,114 @@ import (
 	"errors"
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/wombatwisdom/wombat-builder/public/model"
+	"time"
 )
 
 type Builds struct {
 	kv jetstream.KeyValue
 }
 
+// BuildEntry is a build as it is stored, together with its revision and the time it was last written.
+type BuildEntry struct {
+	Build     *model.Build
+	Revision  uint64
+	UpdatedAt time.Time
+}
+
 func (b *Builds) Watch(ctx context.Context) (jetstream.KeyWatcher, error) {
-	return b.kv.Watch(ctx, "build.>")
+	kw, err := b.kv.Watch(ctx, "build.>")
+	return kw, translateError(err)
+}
+
+// WatchKey watches a single build for changes. Only updates happening after the watch was started are delivered.
+func (b *Builds) WatchKey(ctx context.Context, key string) (jetstream.KeyWatcher, error) {
+	kw, err := b.kv.Watch(ctx, key, jetstream.UpdatesOnly())
+	return kw, translateError(err)
+}
+
+// Follow watches a single build for changes, starting with its current state.
+func (b *Builds) Follow(ctx context.Context, key string) (jetstream.KeyWatcher, error) {
+	kw, err := b.kv.Watch(ctx, key)
+	return kw, translateError(err)
 }
 
 func (b *Builds) Get(ctx context.Context, key string) (*model.Build, error) {
+	build, _, err := b.GetWithRevision(ctx, key)
+	return build, err
+}
+
+// GetWithRevision returns the build together with the revision it was read at, or ErrNotFound.
+func (b *Builds) GetWithRevision(ctx context.Context, key string) (*model.Build, uint64, error) {
 	entry, err := b.kv.Get(ctx, key)
 	if err != nil {
-		if errors.Is(err, jetstream.ErrKeyNotFound) {
-			return nil, nil
-		}
-
-		return nil, err
+		return nil, 0, translateError(err)
 	}
 
 	var build model.Build
 	if err := json.Unmarshal(entry.Value(), &build); err != nil {
+		return nil, 0, err
+	}
+
+	return &build, entry.Revision(), nil
+}
+
+// List returns all builds in the store. Builds removed while listing are skipped.
+func (b *Builds) List(ctx context.Context) ([]BuildEntry, error) {
+	keys, err := b.Keys(ctx)
+	if err != nil {
 		return nil, err
 	}
 
-	return &build, nil
+	result := make([]BuildEntry, 0, len(keys))
+	for _, key := range keys {
+		entry, err := b.kv.Get(ctx, key)
+		if err != nil {
+			if errors.Is(err, jetstream.ErrKeyNotFound) {
+				continue
+			}
+
+			return nil, translateError(err)
+		}
+
+		var build model.Build
+		if err := json.Unmarshal(entry.Value(), &build); err != nil {
+			return nil, err
+		}
+
+		result = append(result, BuildEntry{Build: &build, Revision: entry.Revision(), UpdatedAt: entry.Created()})
+	}
+
+	return result, nil
+}
+
+// Delete removes the build unless it changed since the given revision, in which case ErrConflict is returned.
+func (b *Builds) Delete(ctx context.Context, key string, revision uint64) error {
+	return translateError(b.kv.Delete(ctx, key, jetstream.LastRevision(revision)))
+}
+
+// Keys returns the keys of all builds in the store.
+func (b *Builds) Keys(ctx context.Context) ([]string, error) {
+	keys, err := b.kv.Keys(ctx, jetstream.IgnoreDeletes())
+	if err != nil {
+		if errors.Is(err, jetstream.ErrNoKeysFound) {
+			return []string{}, nil
+		}
+
+		return nil, translateError(err)
+	}
+
+	return keys, nil
 }
 
+// Update writes the build unless it changed since the given revision, in which case ErrConflict is returned.
 func (b *Builds) Update(ctx context.Context, key string, build *model.Build, revision uint64) (uint64, error) {
 	bb, err := json.Marshal(build)
 	if err != nil {
 		return 0, err
 	}
 
-	return b.kv.Update(ctx, key, bb, revision)
+	rev, err := b.kv.Update(ctx, key, bb, revision)
+	return rev, translateError(err)
 }
 
 func (b *Builds) Set(ctx context.Context, build *model.Build) (uint64, error) {
@@ -49,5 +122,6 @@ func (b *Builds) Set(ctx context.Context, build *model.Build) (uint64, error) {
 		return 0, err
 	}
 
-	return b.kv.Put(ctx, build.Id(), data)
+	rev, err := b.kv.Put(ctx, build.Id(), data)
+	return rev, translateError(err)
 }
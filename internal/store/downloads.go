@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog/log"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+)
+
+// downloadsConsumer is the durable consumer shared by all services, so every download event counts once.
+const downloadsConsumer = "download-stats"
+
+func NewDownloads(ctx context.Context, js jetstream.JetStream) (*Downloads, error) {
+	stream, err := js.Stream(ctx, JetstreamStreamDownloads)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Downloads{js: js, stream: stream}, nil
+}
+
+// Downloads holds an event for every artifact download, on the downloads.<build id> subject.
+type Downloads struct {
+	js     jetstream.JetStream
+	stream jetstream.Stream
+}
+
+// Record stores the download event.
+func (d *Downloads) Record(ctx context.Context, event model.DownloadEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.js.Publish(ctx, fmt.Sprintf("downloads.%s", event.BuildId), data)
+	return translateError(err)
+}
+
+// Consume calls fn for every new download event until ctx is done, redelivering events for which fn fails.
+func (d *Downloads) Consume(ctx context.Context, fn func(event model.DownloadEvent) error) error {
+	cons, err := d.stream.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+		Durable:   downloadsConsumer,
+		AckPolicy: jetstream.AckExplicitPolicy,
+	})
+	if err != nil {
+		return translateError(err)
+	}
+
+	it, err := cons.Messages()
+	if err != nil {
+		return translateError(err)
+	}
+	defer it.Stop()
+
+	go func() {
+		<-ctx.Done()
+		it.Stop()
+	}()
+
+	for {
+		msg, err := it.Next()
+		if err != nil {
+			if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+				return ctx.Err()
+			}
+			return translateError(err)
+		}
+
+		var event model.DownloadEvent
+		if err := json.Unmarshal(msg.Data(), &event); err != nil {
+			// -- an event which can not be read will never be readable, so there is no point in redelivering it
+			log.Warn().Err(err).Msg("dropping malformed download event")
+			_ = msg.Term()
+			continue
+		}
+
+		if err := fn(event); err != nil {
+			log.Warn().Err(err).Msgf("failed to process download of %s", event.BuildId)
+			_ = msg.Nak()
+			continue
+		}
+
+		_ = msg.Ack()
+	}
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+var (
+	// ErrConflict is returned when a write was rejected because the entry changed since it was read.
+	ErrConflict = errors.New("conflict")
+
+	// ErrNotFound is returned when the requested entry does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrBackbone is returned when nats itself failed to handle the request. These errors are usually transient.
+	ErrBackbone = errors.New("backbone error")
+)
+
+// translateError maps jetstream errors onto the store errors, keeping the original error in the chain.
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var apiErr *jetstream.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode == jetstream.JSErrCodeStreamWrongLastSequence {
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	}
+
+	if errors.Is(err, jetstream.ErrKeyNotFound) || errors.Is(err, jetstream.ErrObjectNotFound) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+
+	return fmt.Errorf("%w: %w", ErrBackbone, err)
+}
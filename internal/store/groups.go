@@ -0,0 +1,39 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+)
+
+// Groups holds the build groups, keyed by group id.
+type Groups struct {
+	kv jetstream.KeyValue
+}
+
+// Create stores a new group. If a group with the same id already exists, ErrConflict is returned.
+func (g *Groups) Create(ctx context.Context, group model.BuildGroup) error {
+	data, err := json.Marshal(group)
+	if err != nil {
+		return err
+	}
+
+	_, err = g.kv.Create(ctx, group.Id, data)
+	return translateError(err)
+}
+
+// Get returns the group with the given id. If the group does not exist, ErrNotFound is returned.
+func (g *Groups) Get(ctx context.Context, id string) (*model.BuildGroup, error) {
+	entry, err := g.kv.Get(ctx, id)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	var group model.BuildGroup
+	if err := json.Unmarshal(entry.Value(), &group); err != nil {
+		return nil, err
+	}
+
+	return &group, nil
+}
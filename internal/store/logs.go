@@ -0,0 +1,180 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog/log"
+	"io"
+	"sync"
+	"time"
+)
+
+// logEndHeader marks the last message of a build log, so followers know when to stop tailing.
+const logEndHeader = "Wombat-Log-End"
+
+const logPublishTimeout = 5 * time.Second
+
+func NewBuildLogs(ctx context.Context, js jetstream.JetStream) (*BuildLogs, error) {
+	stream, err := js.Stream(ctx, JetstreamStreamBuildLogs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BuildLogs{js: js, stream: stream}, nil
+}
+
+// BuildLogs stores the toolchain output of every build, publishing each line on the logs.<build id> subject.
+type BuildLogs struct {
+	js     jetstream.JetStream
+	stream jetstream.Stream
+}
+
+func (l *BuildLogs) subject(id string) string {
+	return fmt.Sprintf("logs.%s", id)
+}
+
+// Writer returns a writer publishing each line to the log of the build, replacing the log of earlier attempts.
+func (l *BuildLogs) Writer(ctx context.Context, id string) (io.WriteCloser, error) {
+	if err := l.stream.Purge(ctx, jetstream.WithPurgeSubject(l.subject(id))); err != nil {
+		return nil, fmt.Errorf("failed to purge previous log: %w", translateError(err))
+	}
+
+	return &logWriter{js: l.js, subject: l.subject(id)}, nil
+}
+
+// Purge removes the log of the given build.
+func (l *BuildLogs) Purge(ctx context.Context, id string) error {
+	return translateError(l.stream.Purge(ctx, jetstream.WithPurgeSubject(l.subject(id))))
+}
+
+// Read returns all log lines currently stored for the given build.
+func (l *BuildLogs) Read(ctx context.Context, id string) ([]string, error) {
+	cons, err := l.stream.OrderedConsumer(ctx, jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{l.subject(id)},
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	lines := []string{}
+	for {
+		batch, err := cons.FetchNoWait(256)
+		if err != nil {
+			return nil, translateError(err)
+		}
+
+		count := 0
+		for msg := range batch.Messages() {
+			count++
+			if msg.Headers().Get(logEndHeader) == "" {
+				lines = append(lines, string(msg.Data()))
+			}
+		}
+
+		if err := batch.Error(); err != nil {
+			return nil, translateError(err)
+		}
+
+		if count == 0 {
+			return lines, nil
+		}
+	}
+}
+
+// Follow calls fn for every line in the log of the build, including new ones, until the log ends or ctx is done.
+func (l *BuildLogs) Follow(ctx context.Context, id string, fn func(line string) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cons, err := l.stream.OrderedConsumer(ctx, jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{l.subject(id)},
+	})
+	if err != nil {
+		return translateError(err)
+	}
+
+	it, err := cons.Messages()
+	if err != nil {
+		return translateError(err)
+	}
+	defer it.Stop()
+
+	go func() {
+		<-ctx.Done()
+		it.Stop()
+	}()
+
+	for {
+		msg, err := it.Next()
+		if err != nil {
+			if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+				return ctx.Err()
+			}
+			return translateError(err)
+		}
+
+		if msg.Headers().Get(logEndHeader) != "" {
+			return nil
+		}
+
+		if err := fn(string(msg.Data())); err != nil {
+			return err
+		}
+	}
+}
+
+type logWriter struct {
+	js      jetstream.JetStream
+	subject string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+
+		w.publish(&nats.Msg{Subject: w.subject, Data: bytes.TrimSuffix(w.buf[:idx], []byte("\r"))})
+		w.buf = w.buf[idx+1:]
+	}
+
+	return len(p), nil
+}
+
+func (w *logWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) > 0 {
+		w.publish(&nats.Msg{Subject: w.subject, Data: w.buf})
+		w.buf = nil
+	}
+
+	end := nats.NewMsg(w.subject)
+	end.Header.Set(logEndHeader, "true")
+	w.publish(end)
+	return nil
+}
+
+// publish sends the message to the log stream, only logging failures since the log should never fail the build.
+func (w *logWriter) publish(msg *nats.Msg) {
+	ctx, cancel := context.WithTimeout(context.Background(), logPublishTimeout)
+	defer cancel()
+
+	msg.Data = bytes.Clone(msg.Data)
+	if _, err := w.js.PublishMsg(ctx, msg); err != nil {
+		log.Warn().Err(err).Msgf("failed to publish log line to %s", w.subject)
+	}
+}
@@ -0,0 +1,225 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// profilePrefix is the prefix of the keys holding the versions of a profile, as profile.<name>.<version>.
+const profilePrefix = "profile."
+
+// profileVersionPrefix is the prefix of the keys holding the highest version a profile ever had.
+const profileVersionPrefix = "profile-version."
+
+// Profiles holds the distribution profiles.
+type Profiles struct {
+	kv jetstream.KeyValue
+}
+
+// Create stores a new version of a profile, or returns ErrConflict when the version was ever used before.
+func (p *Profiles) Create(ctx context.Context, profile model.Profile) error {
+	highest, rev, err := p.highestVersion(ctx, profile.Name)
+	if err != nil {
+		return err
+	}
+
+	if profile.Version <= highest {
+		return fmt.Errorf("version %d of profile %s was used before: %w", profile.Version, profile.Name, ErrConflict)
+	}
+
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+
+	if _, err := p.kv.Create(ctx, profileKey(profile.Name, profile.Version), data); err != nil {
+		return translateError(err)
+	}
+
+	return p.raiseHighestVersion(ctx, profile.Name, profile.Version, rev)
+}
+
+// NextVersion returns the version after the highest one the profile ever had, even if it was deleted since.
+func (p *Profiles) NextVersion(ctx context.Context, name string) (int, error) {
+	highest, _, err := p.highestVersion(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	return highest + 1, nil
+}
+
+// highestVersion returns the highest version the profile ever had and the revision of its key, or zeroes.
+func (p *Profiles) highestVersion(ctx context.Context, name string) (int, uint64, error) {
+	entry, err := p.kv.Get(ctx, profileVersionPrefix+name)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			return 0, 0, nil
+		}
+		return 0, 0, translateError(err)
+	}
+
+	version, err := strconv.Atoi(string(entry.Value()))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid highest version of profile %s: %w", name, err)
+	}
+
+	return version, entry.Revision(), nil
+}
+
+// raiseHighestVersion records the version as the highest of the profile, unless a higher one was recorded.
+func (p *Profiles) raiseHighestVersion(ctx context.Context, name string, version int, rev uint64) error {
+	for {
+		var err error
+		value := []byte(strconv.Itoa(version))
+		if rev == 0 {
+			_, err = p.kv.Create(ctx, profileVersionPrefix+name, value)
+		} else {
+			_, err = p.kv.Update(ctx, profileVersionPrefix+name, value, rev)
+		}
+
+		if err = translateError(err); !errors.Is(err, ErrConflict) {
+			return err
+		}
+
+		var highest int
+		if highest, rev, err = p.highestVersion(ctx, name); err != nil || highest >= version {
+			return err
+		}
+	}
+}
+
+// Get returns a version of the profile, or its latest version when version is 0.
+func (p *Profiles) Get(ctx context.Context, name string, version int) (*model.Profile, error) {
+	if version == 0 {
+		versions, err := p.Versions(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		version = versions[len(versions)-1]
+	}
+
+	entry, err := p.kv.Get(ctx, profileKey(name, version))
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	var profile model.Profile
+	if err := json.Unmarshal(entry.Value(), &profile); err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+// History returns every version of the profile, oldest first.
+func (p *Profiles) History(ctx context.Context, name string) ([]model.Profile, error) {
+	versions, err := p.Versions(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]model.Profile, 0, len(versions))
+	for _, v := range versions {
+		profile, err := p.Get(ctx, name, v)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		result = append(result, *profile)
+	}
+
+	return result, nil
+}
+
+// Versions returns the versions of the profile in ascending order, or ErrNotFound.
+func (p *Profiles) Versions(ctx context.Context, name string) ([]int, error) {
+	keys, err := watchKeys(ctx, p.kv, fmt.Sprintf("%s%s.*", profilePrefix, name))
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int
+	for _, key := range keys {
+		if v, err := strconv.Atoi(key[strings.LastIndex(key, ".")+1:]); err == nil {
+			versions = append(versions, v)
+		}
+	}
+
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("profile %s: %w", name, ErrNotFound)
+	}
+
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// Names returns the names of all profiles.
+func (p *Profiles) Names(ctx context.Context) ([]string, error) {
+	keys, err := watchKeys(ctx, p.kv, profilePrefix+">")
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	result := []string{}
+	for _, key := range keys {
+		name := strings.Split(strings.TrimPrefix(key, profilePrefix), ".")[0]
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// Delete removes every version of the profile, but keeps its highest version so versions are never reused.
+func (p *Profiles) Delete(ctx context.Context, name string) error {
+	versions, err := p.Versions(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range versions {
+		if err := p.kv.Purge(ctx, profileKey(name, v)); err != nil {
+			return translateError(err)
+		}
+	}
+
+	return nil
+}
+
+func profileKey(name string, version int) string {
+	return fmt.Sprintf("%s%s.%d", profilePrefix, name, version)
+}
+
+// watchKeys returns the keys matching the filter, without fetching their values.
+func watchKeys(ctx context.Context, kv jetstream.KeyValue, filter string) ([]string, error) {
+	w, err := kv.Watch(ctx, filter, jetstream.MetaOnly(), jetstream.IgnoreDeletes())
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer w.Stop()
+
+	var keys []string
+	for entry := range w.Updates() {
+		// -- a nil entry marks the end of the current values
+		if entry == nil {
+			break
+		}
+		keys = append(keys, entry.Key())
+	}
+
+	return keys, nil
+}
@@ -1,7 +1,89 @@
 package store
 
-import "github.com/nats-io/nats.go/jetstream"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"sort"
+	"strings"
+)
 
+// repoPrefix is the prefix of the repository keys within the repos bucket, which holds the profiles as well.
+const repoPrefix = "repo."
+
+// Repos holds the registered component repositories, keyed by name.
 type Repos struct {
-  kv jetstream.KeyValue
+	kv jetstream.KeyValue
+}
+
+// Create registers a repository. If a repository with the same name already exists, ErrConflict is returned.
+func (r *Repos) Create(ctx context.Context, repo model.Repo) error {
+	data, err := json.Marshal(repo)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.kv.Create(ctx, repoPrefix+repo.Name, data)
+	return translateError(err)
+}
+
+// Get returns the repository together with the revision it was read at, or ErrNotFound.
+func (r *Repos) Get(ctx context.Context, name string) (*model.Repo, uint64, error) {
+	entry, err := r.kv.Get(ctx, repoPrefix+name)
+	if err != nil {
+		return nil, 0, translateError(err)
+	}
+
+	var repo model.Repo
+	if err := json.Unmarshal(entry.Value(), &repo); err != nil {
+		return nil, 0, err
+	}
+
+	return &repo, entry.Revision(), nil
+}
+
+// Update writes the repository unless it changed since the given revision, in which case ErrConflict is returned.
+func (r *Repos) Update(ctx context.Context, repo *model.Repo, revision uint64) (uint64, error) {
+	data, err := json.Marshal(repo)
+	if err != nil {
+		return 0, err
+	}
+
+	rev, err := r.kv.Update(ctx, repoPrefix+repo.Name, data, revision)
+	return rev, translateError(err)
+}
+
+// List returns all registered repositories, ordered by name. Repositories removed while listing are skipped.
+func (r *Repos) List(ctx context.Context) ([]model.Repo, error) {
+	keys, err := watchKeys(ctx, r.kv, repoPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	result := make([]model.Repo, 0, len(keys))
+	for _, key := range keys {
+		repo, _, err := r.Get(ctx, strings.TrimPrefix(key, repoPrefix))
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+
+			return nil, err
+		}
+		result = append(result, *repo)
+	}
+
+	return result, nil
+}
+
+// Delete removes the repository, keeping the versions it added to the catalog.
+func (r *Repos) Delete(ctx context.Context, name string) error {
+	if _, _, err := r.Get(ctx, name); err != nil {
+		return err
+	}
+
+	return translateError(r.kv.Purge(ctx, repoPrefix+name))
 }
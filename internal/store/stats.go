@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+)
+
+// updateAttempts is the number of times a counter update is retried when someone else updated it at the same time.
+const updateAttempts = 5
+
+// Stats holds the download statistics of every build, keyed by build id.
+type Stats struct {
+	kv jetstream.KeyValue
+}
+
+// Update applies fn to the statistics of the build, which are empty if it was never downloaded before.
+func (s *Stats) Update(ctx context.Context, id string, fn func(stats *model.DownloadStats) error) error {
+	var err error
+	for i := 0; i < updateAttempts; i++ {
+		if err = s.update(ctx, id, fn); !errors.Is(err, ErrConflict) {
+			return err
+		}
+	}
+
+	return err
+}
+
+func (s *Stats) update(ctx context.Context, id string, fn func(stats *model.DownloadStats) error) error {
+	var stats model.DownloadStats
+	var rev uint64
+
+	entry, err := s.kv.Get(ctx, id)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(entry.Value(), &stats); err != nil {
+			return err
+		}
+		rev = entry.Revision()
+	case !errors.Is(err, jetstream.ErrKeyNotFound):
+		return translateError(err)
+	}
+
+	if err := fn(&stats); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+
+	// -- creating a key which was created in the meantime is reported as a conflict as well
+	if rev == 0 {
+		_, err = s.kv.Create(ctx, id, data)
+	} else {
+		_, err = s.kv.Update(ctx, id, data, rev)
+	}
+
+	return translateError(err)
+}
+
+// Delete removes the statistics of the build.
+func (s *Stats) Delete(ctx context.Context, id string) error {
+	err := s.kv.Delete(ctx, id)
+	if err != nil && !errors.Is(err, jetstream.ErrKeyNotFound) {
+		return translateError(err)
+	}
+
+	return nil
+}
+
+// List returns the statistics of all builds which were downloaded at least once.
+func (s *Stats) List(ctx context.Context) ([]model.DownloadStats, error) {
+	keys, err := s.kv.Keys(ctx, jetstream.IgnoreDeletes())
+	if err != nil {
+		if errors.Is(err, jetstream.ErrNoKeysFound) {
+			return []model.DownloadStats{}, nil
+		}
+
+		return nil, translateError(err)
+	}
+
+	result := make([]model.DownloadStats, 0, len(keys))
+	for _, key := range keys {
+		entry, err := s.kv.Get(ctx, key)
+		if err != nil {
+			if errors.Is(err, jetstream.ErrKeyNotFound) {
+				continue
+			}
+
+			return nil, translateError(err)
+		}
+
+		var stats model.DownloadStats
+		if err := json.Unmarshal(entry.Value(), &stats); err != nil {
+			return nil, err
+		}
+		result = append(result, stats)
+	}
+
+	return result, nil
+}
@@ -7,8 +7,15 @@ import (
 
 const (
   JetstreamKVBuilds    = "builds"
+  JetstreamKVBuilders  = "builders"
+  JetstreamKVGroups    = "build_groups"
+  JetstreamKVProfiles  = "profiles"
   JetstreamKVRepos     = "repos"
+  JetstreamKVStats     = "download_stats"
   JetstreamOSArtifacts = "artifacts"
+
+  JetstreamStreamBuildLogs = "build_logs"
+  JetstreamStreamDownloads = "downloads"
 )
 
 func NewStore(js jetstream.JetStream, withIndex bool) (*Store, error) {
@@ -18,16 +25,46 @@ func NewStore(js jetstream.JetStream, withIndex bool) (*Store, error) {
     return nil, err
   }
 
+  builders, err := js.KeyValue(ctx, JetstreamKVBuilders)
+  if err != nil {
+    return nil, err
+  }
+
+  groups, err := js.KeyValue(ctx, JetstreamKVGroups)
+  if err != nil {
+    return nil, err
+  }
+
+  profiles, err := js.KeyValue(ctx, JetstreamKVProfiles)
+  if err != nil {
+    return nil, err
+  }
+
   repos, err := js.KeyValue(ctx, JetstreamKVRepos)
   if err != nil {
     return nil, err
   }
 
+  stats, err := js.KeyValue(ctx, JetstreamKVStats)
+  if err != nil {
+    return nil, err
+  }
+
   artifacts, err := js.ObjectStore(ctx, JetstreamOSArtifacts)
   if err != nil {
     return nil, err
   }
 
+  logs, err := NewBuildLogs(ctx, js)
+  if err != nil {
+    return nil, err
+  }
+
+  downloads, err := NewDownloads(ctx, js)
+  if err != nil {
+    return nil, err
+  }
+
   var bi *BuildIndex
   if withIndex {
     bi, err = NewBuildIndex(ctx, js)
@@ -39,14 +76,26 @@ func NewStore(js jetstream.JetStream, withIndex bool) (*Store, error) {
   return &Store{
     Artifacts:   &Artifacts{obj: artifacts},
     Builds:      &Builds{kv: builds},
+    Builders:    &Builders{kv: builders},
+    Groups:      &Groups{kv: groups},
+    Profiles:    &Profiles{kv: profiles},
     Repos:       &Repos{kv: repos},
     BuildsIndex: bi,
+    Downloads:   downloads,
+    Logs:        logs,
+    Stats:       &Stats{kv: stats},
   }, nil
 }
 
 type Store struct {
   Artifacts   *Artifacts
   Builds      *Builds
+  Builders    *Builders
   BuildsIndex *BuildIndex
+  Downloads   *Downloads
+  Groups      *Groups
+  Logs        *BuildLogs
+  Profiles    *Profiles
   Repos       *Repos
+  Stats       *Stats
 }
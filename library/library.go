@@ -66,6 +66,10 @@ func (c *fsClient) AddLibrary(library Spec) error {
 		return fmt.Errorf("invalid library name %q. must be lowercase and only contain - or _", library.Name)
 	}
 
+	if library.Access != nil && library.Access.Secret != "" && !nameRegex.MatchString(library.Access.Secret) {
+		return fmt.Errorf("invalid secret name %q. must be lowercase and only contain - or _", library.Access.Secret)
+	}
+
 	libFile := path.Join(c.basePath, library.Name, "library.json")
 
 	// -- create the lib dir
@@ -0,0 +1,96 @@
+package library
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Mirror is a local bare mirror of a git repository, read from disk without needing git or the network.
+type Mirror struct {
+	dir string
+}
+
+// OpenMirror opens the bare repository in dir.
+func OpenMirror(dir string) (*Mirror, error) {
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil {
+		return nil, fmt.Errorf("%s is not a bare git repository: %w", dir, err)
+	}
+
+	return &Mirror{dir: dir}, nil
+}
+
+// DefaultBranch returns the branch HEAD points to.
+func (m *Mirror) DefaultBranch() (string, error) {
+	b, err := os.ReadFile(filepath.Join(m.dir, "HEAD"))
+	if err != nil {
+		return "", err
+	}
+
+	ref, ok := strings.CutPrefix(strings.TrimSpace(string(b)), "ref: ")
+	if !ok {
+		return "", fmt.Errorf("HEAD of %s is detached", m.dir)
+	}
+
+	return strings.TrimPrefix(ref, "refs/heads/"), nil
+}
+
+// Tags returns the names of both the packed and the loose tags in the repository, sorted by name.
+func (m *Mirror) Tags() ([]string, error) {
+	seen := map[string]bool{}
+
+	f, err := os.Open(filepath.Join(m.dir, "packed-refs"))
+	switch {
+	case err == nil:
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			// -- lines are either comments, peeled tags (^<sha>) or <sha> <ref>
+			line := scanner.Text()
+			if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+				continue
+			}
+
+			_, ref, ok := strings.Cut(line, " ")
+			if tag, isTag := strings.CutPrefix(ref, "refs/tags/"); ok && isTag {
+				seen[tag] = true
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read packed refs: %w", err)
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	root := filepath.Join(m.dir, "refs", "tags")
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			rel, _ := filepath.Rel(root, p)
+			seen[path.Clean(filepath.ToSlash(rel))] = true
+		}
+
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read tags: %w", err)
+	}
+
+	result := make([]string, 0, len(seen))
+	for tag := range seen {
+		result = append(result, tag)
+	}
+	sort.Strings(result)
+
+	return result, nil
+}
@@ -0,0 +1,132 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeMirror creates a bare repository holding the packed refs and a loose ref for each of the loose tags.
+func writeMirror(t *testing.T, head string, packed []string, loose []string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	files := map[string]string{"HEAD": head + "\n"}
+
+	if packed != nil {
+		var sb strings.Builder
+		sb.WriteString("# pack-refs with: peeled fully-peeled sorted \n")
+		for _, ref := range packed {
+			sb.WriteString("1111111111111111111111111111111111111111 " + ref + "\n")
+			if strings.HasPrefix(ref, "refs/tags/") {
+				sb.WriteString("^2222222222222222222222222222222222222222\n")
+			}
+		}
+		files["packed-refs"] = sb.String()
+	}
+
+	for _, tag := range loose {
+		files[filepath.Join("refs", "tags", filepath.FromSlash(tag))] = "3333333333333333333333333333333333333333\n"
+	}
+
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestMirrorTags(t *testing.T) {
+	tests := []struct {
+		name   string
+		packed []string
+		loose  []string
+		want   []string
+	}{
+		{
+			name:   "packed and loose",
+			packed: []string{"refs/heads/main", "refs/tags/v1.0.0", "refs/tags/v1.1.0"},
+			loose:  []string{"v1.2.0", "nested/v0.1.0"},
+			want:   []string{"nested/v0.1.0", "v1.0.0", "v1.1.0", "v1.2.0"},
+		},
+		{
+			name:   "tag both packed and loose",
+			packed: []string{"refs/tags/v1.0.0"},
+			loose:  []string{"v1.0.0"},
+			want:   []string{"v1.0.0"},
+		},
+		{
+			name:  "only loose",
+			loose: []string{"v2.0.0"},
+			want:  []string{"v2.0.0"},
+		},
+		{
+			name:   "only packed",
+			packed: []string{"refs/heads/main", "refs/remotes/origin/v9", "refs/tags/v0.1.0"},
+			want:   []string{"v0.1.0"},
+		},
+		{
+			name: "no tags",
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := OpenMirror(writeMirror(t, "ref: refs/heads/main", tt.packed, tt.loose))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := m.Tags()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got tags %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMirrorDefaultBranch(t *testing.T) {
+	m, err := OpenMirror(writeMirror(t, "ref: refs/heads/develop", nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	branch, err := m.DefaultBranch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if branch != "develop" {
+		t.Errorf("got default branch %q, want develop", branch)
+	}
+}
+
+func TestMirrorDetachedHead(t *testing.T) {
+	m, err := OpenMirror(writeMirror(t, "1111111111111111111111111111111111111111", nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.DefaultBranch(); err == nil {
+		t.Error("expected an error for a detached HEAD")
+	}
+}
+
+func TestOpenMirrorNotARepository(t *testing.T) {
+	if _, err := OpenMirror(t.TempDir()); err == nil {
+		t.Error("expected an error for a directory without HEAD")
+	}
+}
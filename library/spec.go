@@ -4,6 +4,25 @@ package library
 type Spec struct {
 	Name   string `json:"name"`
 	Module string `json:"module"`
+
+	// Access holds how to reach the module of a private library. Public libraries leave it empty.
+	Access *AccessSpec `json:"access,omitempty"`
+}
+
+// AccessSpec describes how to reach a private library, naming the secret holding the token.
+type AccessSpec struct {
+	// Private fetches the module directly from its origin, bypassing the public proxy and checksum database.
+	Private bool `json:"private,omitempty"`
+
+	// Proxy is a module proxy serving the module, like an internal Athens instance.
+	Proxy string `json:"proxy,omitempty"`
+
+	// Host is the host the credentials are presented to. Defaults to the host in the module path.
+	Host string `json:"host,omitempty"`
+
+	// Secret is the name of the secret holding the token and Username the user to present it as.
+	Secret   string `json:"secret,omitempty"`
+	Username string `json:"username,omitempty"`
 }
 
 // VersionSpec represents a version of a library. It can refer to a specific tag or branch within a git repository
@@ -16,6 +16,7 @@ func main() {
 			cmd.ServiceCommand,
 			cmd.ApiCommand,
 			cmd.AllCommand,
+			cmd.CacheCommand,
 		},
 	}
 
@@ -0,0 +1,22 @@
+package model
+
+type (
+	// ModuleAccess tells the builder how to reach a private module, referring to credentials by secret name.
+	ModuleAccess struct {
+		// Module is the module path prefix the settings apply to.
+		Module string `json:"module"`
+
+		// Private modules are fetched directly from their origin and not checked against the checksum database.
+		Private bool `json:"private,omitempty"`
+
+		// Proxy is the module proxy serving the module, tried before the default proxies.
+		Proxy string `json:"proxy,omitempty"`
+
+		// Host is the host the credentials are presented to. Defaults to the host in the module path.
+		Host string `json:"host,omitempty"`
+
+		// Secret is the name of the secret holding the token to authenticate with, as Username.
+		Secret   string `json:"secret,omitempty"`
+		Username string `json:"username,omitempty"`
+	}
+)
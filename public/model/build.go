@@ -6,6 +6,7 @@ import (
   "github.com/rs/zerolog/log"
   "sort"
   "strings"
+  "time"
 )
 
 type (
@@ -14,6 +15,21 @@ type (
     Goarch    string    `json:"goarch"`
     GoVersion string    `json:"goversion"`
     Packages  []Package `json:"packages"`
+
+    // Constraints holds what the builder needs to be capable of, beyond building for the platform and go version.
+    Constraints *BuildConstraints `json:"constraints,omitempty"`
+
+    // Distribution brands the binary with a name, version and banner. Builds without one produce a plain wombat.
+    Distribution *Distribution `json:"distribution,omitempty"`
+  }
+
+  // BuildConstraints are the capabilities a build requires from the builder taking it up.
+  BuildConstraints struct {
+    // Cgo builds with cgo enabled, which needs a C compiler for the target platform.
+    Cgo bool `json:"cgo,omitempty"`
+
+    // Plugin builds a go plugin instead of an executable. Plugins need cgo and can only be built natively.
+    Plugin bool `json:"plugin,omitempty"`
   }
   Build struct {
     BuildIdentity
@@ -21,8 +37,60 @@ type (
     Builder  string            `json:"builder,omitempty"`
     Status   BuildStatus       `json:"status"`
     Error    string            `json:"error,omitempty"`
+
+    // Variants refers to the compressed copies of the artifact and the archive bundling it.
+    Variants *ArtifactVariants `json:"variants,omitempty"`
+
+    // Modules refers to the go.mod, go.sum and module list the artifact was built from.
+    Modules *ModuleReferences `json:"modules,omitempty"`
+
+    // SBOM refers to the software bills of materials describing the artifact.
+    SBOM *SBOMReferences `json:"sbom,omitempty"`
+
+    // Access holds how to reach the private modules the build depends on.
+    Access []ModuleAccess `json:"access,omitempty"`
+
+    // Pinned builds are never removed by the garbage collection.
+    Pinned bool `json:"pinned,omitempty"`
+
+    // Priority orders the builds waiting for a builder, Requester is who asked for the build.
+    Priority  int    `json:"priority,omitempty"`
+    Requester string `json:"requester,omitempty"`
+
+    // Reclaims counts how many times the build was taken back from a builder which stopped sending heartbeats.
+    Reclaims int `json:"reclaims,omitempty"`
+
+    // Attempts counts the builder runs; transient failures are retried until MaxAttempts, not before NextAttemptAt.
+    Attempts      int        `json:"attempts,omitempty"`
+    MaxAttempts   int        `json:"max_attempts,omitempty"`
+    NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+
+    // FailureReason tells why a failed build failed.
+    FailureReason FailureReason `json:"failure_reason,omitempty"`
+
+    // Timeouts overrides the timeouts the builder applies to the toolchain phases of this build.
+    Timeouts *PhaseTimeouts `json:"timeouts,omitempty"`
+
+    // Phases holds the progress of the latest attempt, in the order the phases were started.
+    Phases []Phase `json:"phases,omitempty"`
   }
 
+  // PhaseTimeouts holds the maximum duration of each toolchain phase, zero falls back to the builder default.
+  PhaseTimeouts struct {
+    Get   Duration `json:"get,omitempty"`
+    Tidy  Duration `json:"tidy,omitempty"`
+    Build Duration `json:"build,omitempty"`
+  }
+
+  // ArtifactVariants point to the alternative forms in which an artifact is stored.
+  ArtifactVariants struct {
+    Gzip   ArtifactReference `json:"gzip,omitempty"`
+    Zstd   ArtifactReference `json:"zstd,omitempty"`
+    Bundle ArtifactReference `json:"bundle,omitempty"`
+  }
+
+  FailureReason string
+
   ArtifactReference string
   BuildStatus       string
 
@@ -30,12 +98,33 @@ type (
 )
 
 const (
-  BuildStatusNew      BuildStatus = "new"
-  BuildStatusBuilding BuildStatus = "building"
-  BuildStatusSuccess  BuildStatus = "success"
-  BuildStatusFailed   BuildStatus = "failed"
+  // MinPriority and MaxPriority bound the priority of a build.
+  MinPriority = -10
+  MaxPriority = 10
 )
 
+const (
+  BuildStatusNew       BuildStatus = "new"
+  BuildStatusBuilding  BuildStatus = "building"
+  BuildStatusSuccess   BuildStatus = "success"
+  BuildStatusFailed    BuildStatus = "failed"
+  BuildStatusCancelled BuildStatus = "cancelled"
+)
+
+const (
+  // FailureReasonTimeout means one of the toolchain phases took longer than allowed.
+  FailureReasonTimeout FailureReason = "timeout"
+  // FailureReasonTransient means the build kept failing for reasons which usually go away, until it ran out of attempts.
+  FailureReasonTransient FailureReason = "transient"
+  // FailureReasonBuild means the build failed because of the code being built, like a compile error.
+  FailureReasonBuild FailureReason = "build"
+)
+
+// IsTerminal returns true if a build in this status will not be picked up by a builder anymore.
+func (s BuildStatus) IsTerminal() bool {
+  return s == BuildStatusSuccess || s == BuildStatusFailed || s == BuildStatusCancelled
+}
+
 func WithPackage(pkg ...Package) BuildOpt {
   return func(b *Build) {
     b.Packages = append(b.Packages, pkg...)
@@ -50,6 +139,55 @@ func WithPackageUrls(pkg ...string) BuildOpt {
   }
 }
 
+func WithMaxAttempts(attempts int) BuildOpt {
+  return func(b *Build) {
+    b.MaxAttempts = attempts
+  }
+}
+
+func WithTimeouts(timeouts *PhaseTimeouts) BuildOpt {
+  return func(b *Build) {
+    b.Timeouts = timeouts
+  }
+}
+
+// WithConstraints sets the capabilities a builder needs to take up the build.
+func WithConstraints(constraints BuildConstraints) BuildOpt {
+  return func(b *Build) {
+    if constraints == (BuildConstraints{}) {
+      b.Constraints = nil
+      return
+    }
+
+    b.Constraints = &constraints
+  }
+}
+
+// WithDistribution brands the binary produced by the build.
+func WithDistribution(distribution *Distribution) BuildOpt {
+  return func(b *Build) {
+    b.Distribution = distribution
+  }
+}
+
+func WithAccess(access []ModuleAccess) BuildOpt {
+  return func(b *Build) {
+    b.Access = access
+  }
+}
+
+func WithPriority(priority int) BuildOpt {
+  return func(b *Build) {
+    b.Priority = priority
+  }
+}
+
+func WithRequester(requester string) BuildOpt {
+  return func(b *Build) {
+    b.Requester = requester
+  }
+}
+
 func WithGoVersion(version string) BuildOpt {
   return func(b *Build) {
     b.GoVersion = version
@@ -77,16 +215,81 @@ func NewBuild(opts ...BuildOpt) (*Build, error) {
     opt(b)
   }
 
+  for _, p := range b.Packages {
+    if err := p.Validate(); err != nil {
+      return nil, err
+    }
+  }
+
+  // -- a module can only be required once, so all packages from the same module need to agree on the version
+  pins := map[string]string{}
+  for _, p := range b.Packages {
+    if !p.IsPinned() {
+      continue
+    }
+
+    if v, fnd := pins[p.Module]; fnd && v != p.Version {
+      return nil, fmt.Errorf("module %s is pinned to both %s and %s", p.Module, v, p.Version)
+    }
+    pins[p.Module] = p.Version
+  }
+
   return b, nil
 }
 
+// Requirements returns the pinned modules of the build, sorted by module.
+func (b Build) Requirements() []Requirement {
+  pins := map[string]string{}
+  for _, p := range b.Packages {
+    if p.IsPinned() {
+      pins[p.Module] = p.Version
+    }
+  }
+
+  result := make([]Requirement, 0, len(pins))
+  for m, v := range pins {
+    result = append(result, Requirement{Module: m, Version: v})
+  }
+  sort.Slice(result, func(i, j int) bool {
+    return result[i].Module < result[j].Module
+  })
+
+  return result
+}
+
+// CanRetry returns true if the build has attempts left.
+func (b Build) CanRetry() bool {
+  return b.Attempts < b.MaxAttempts
+}
+
+// IsDue returns true if the build may be attempted right now.
+func (b Build) IsDue(now time.Time) bool {
+  return b.NextAttemptAt == nil || !now.Before(*b.NextAttemptAt)
+}
+
 func (b Build) Id() string {
   sort.Slice(b.Packages, func(i, j int) bool {
     return b.Packages[i].Url < b.Packages[j].Url
   })
 
-  // -- create a hash for the build
-  hash, err := hashstructure.Hash(b.Packages, hashstructure.FormatV2, nil)
+  // -- create a hash for the build. Since the pinned versions are part of the packages, builds of the same packages
+  // -- at different versions end up with different ids
+  // -- the constraints and distribution only take part when set, so builds without any keep the id they always had
+  var subject interface{} = b.Packages
+  if b.Distribution != nil {
+    subject = struct {
+      Packages     []Package
+      Constraints  *BuildConstraints
+      Distribution Distribution
+    }{b.Packages, b.Constraints, *b.Distribution}
+  } else if b.Constraints != nil {
+    subject = struct {
+      Packages    []Package
+      Constraints BuildConstraints
+    }{b.Packages, *b.Constraints}
+  }
+
+  hash, err := hashstructure.Hash(subject, hashstructure.FormatV2, nil)
   if err != nil {
     log.Panic().Err(err).Msg("failed to hash build")
   }
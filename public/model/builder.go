@@ -0,0 +1,82 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+type (
+	// BuilderLease is the heartbeat of a builder, vouching for the builds it claimed while it exists.
+	BuilderLease struct {
+		Id        string    `json:"id"`
+		Workers   int       `json:"workers"`
+		Builds    []string  `json:"builds"`
+		StartedAt time.Time `json:"started_at"`
+		LastSeen  time.Time `json:"last_seen"`
+
+		// Capabilities describes what the builder is able to build.
+		Capabilities BuilderCapabilities `json:"capabilities"`
+	}
+
+	// BuilderCapabilities is the capability document of a builder. Builders only claim the builds they are capable of.
+	BuilderCapabilities struct {
+		// Host is the platform the builder runs on.
+		Host Platform `json:"host"`
+
+		// Platforms lists the platforms the builder can build for.
+		Platforms []Platform `json:"platforms"`
+
+		// GoVersions lists the go toolchains the builder has at hand, besides any it may download.
+		GoVersions        []string `json:"go_versions,omitempty"`
+		ToolchainDownload bool     `json:"toolchain_download,omitempty"`
+
+		// CgoCompilers holds the C compiler used for cgo builds, by the goos/goarch of the platform it compiles for.
+		CgoCompilers map[string]string `json:"cgo_compilers,omitempty"`
+
+		// Plugin tells whether the builder can build go plugins for its host platform.
+		Plugin bool `json:"plugin,omitempty"`
+	}
+
+	// Platform is a target of the go toolchain.
+	Platform struct {
+		Goos   string `json:"goos"`
+		Goarch string `json:"goarch"`
+	}
+)
+
+// ParsePlatform parses a platform in the goos/goarch notation.
+func ParsePlatform(s string) (Platform, error) {
+	goos, goarch, ok := strings.Cut(s, "/")
+	if !ok || goos == "" || goarch == "" {
+		return Platform{}, fmt.Errorf("invalid platform %q, expected goos/goarch", s)
+	}
+
+	return Platform{Goos: goos, Goarch: goarch}, nil
+}
+
+func (p Platform) String() string {
+	return fmt.Sprintf("%s/%s", p.Goos, p.Goarch)
+}
+
+// Accepts tells whether the builder can build for the platform with the given constraints.
+func (c BuilderCapabilities) Accepts(target Platform, constraints *BuildConstraints) bool {
+	if !slices.Contains(c.Platforms, target) {
+		return false
+	}
+
+	if constraints == nil {
+		return true
+	}
+
+	if (constraints.Cgo || constraints.Plugin) && c.CgoCompilers[target.String()] == "" {
+		return false
+	}
+
+	if constraints.Plugin && (!c.Plugin || target != c.Host) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultDistributionName is the name of the binaries built without a distribution.
+const DefaultDistributionName = "wombat"
+
+var distributionNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._\-]*$`)
+
+// Distribution brands the binary of a build with a name, version, banner and default config paths.
+type Distribution struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+
+	// Banner is printed to stderr when the binary starts running a config.
+	Banner string `json:"banner,omitempty"`
+
+	// ConfigPaths are the paths the binary looks for a config at when none is given.
+	ConfigPaths []string `json:"config_paths,omitempty"`
+}
+
+func (d *Distribution) Validate() error {
+	if !distributionNameRegex.MatchString(d.Name) {
+		return fmt.Errorf("invalid distribution name %q. must start with a letter or digit and only contain letters, digits, ., - or _", d.Name)
+	}
+
+	if strings.ContainsAny(d.Version, " \t\r\n'\"") {
+		return fmt.Errorf("invalid distribution version %q. must not contain whitespace or quotes", d.Version)
+	}
+
+	for _, p := range d.ConfigPaths {
+		if p == "" {
+			return fmt.Errorf("config paths can not be empty")
+		}
+	}
+
+	return nil
+}
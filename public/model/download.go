@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+type (
+	// DownloadEvent records a single download of an artifact.
+	DownloadEvent struct {
+		BuildId   string    `json:"build_id"`
+		Object    string    `json:"object"`
+		Timestamp time.Time `json:"timestamp"`
+		UserAgent string    `json:"user_agent,omitempty"`
+		Bytes     int64     `json:"bytes"`
+	}
+
+	// DownloadStats aggregates the downloads of a single build.
+	DownloadStats struct {
+		BuildId        string    `json:"build_id"`
+		Goos           string    `json:"goos"`
+		Goarch         string    `json:"goarch"`
+		Packages       []string  `json:"packages"`
+		Downloads      int64     `json:"downloads"`
+		Bytes          int64     `json:"bytes"`
+		LastDownloadAt time.Time `json:"last_download_at"`
+	}
+)
+
+// Add counts the download event.
+func (s *DownloadStats) Add(event DownloadEvent) {
+	s.Downloads++
+	s.Bytes += event.Bytes
+	if event.Timestamp.After(s.LastDownloadAt) {
+		s.LastDownloadAt = event.Timestamp
+	}
+}
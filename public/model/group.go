@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// BuildGroup ties together the builds which were requested at once, like the targets of a build matrix.
+type BuildGroup struct {
+	Id        string    `json:"id"`
+	Builds    []string  `json:"builds"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BuildStatusExpired is reported for the builds of a group which were garbage collected since.
+const BuildStatusExpired BuildStatus = "expired"
+
+// GroupStatus aggregates the status of the builds in a group, leaving out the expired ones.
+func GroupStatus(statuses ...BuildStatus) BuildStatus {
+	counts := map[BuildStatus]int{}
+	var remaining []BuildStatus
+	for _, s := range statuses {
+		counts[s]++
+		if s != BuildStatusExpired {
+			remaining = append(remaining, s)
+		}
+	}
+	statuses = remaining
+
+	switch {
+	case len(statuses) == 0 && counts[BuildStatusExpired] > 0:
+		return BuildStatusExpired
+	case len(statuses) == 0:
+		return BuildStatusNew
+	case counts[BuildStatusNew] == len(statuses):
+		return BuildStatusNew
+	case counts[BuildStatusNew]+counts[BuildStatusBuilding] > 0:
+		return BuildStatusBuilding
+	case counts[BuildStatusSuccess] == len(statuses):
+		return BuildStatusSuccess
+	case counts[BuildStatusCancelled] == len(statuses):
+		return BuildStatusCancelled
+	default:
+		return BuildStatusFailed
+	}
+}
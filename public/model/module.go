@@ -0,0 +1,65 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+type (
+	// ModuleReferences point to the module files stored next to the artifact, telling which versions went into it.
+	ModuleReferences struct {
+		GoMod ArtifactReference `json:"go_mod"`
+		GoSum ArtifactReference `json:"go_sum,omitempty"`
+		List  ArtifactReference `json:"list"`
+	}
+
+	// SBOMReferences point to the software bills of materials generated for an artifact, one per format.
+	SBOMReferences struct {
+		CycloneDX ArtifactReference `json:"cyclonedx,omitempty"`
+		SPDX      ArtifactReference `json:"spdx,omitempty"`
+	}
+
+	// Module is a module in the build list of a build.
+	Module struct {
+		Path    string  `json:"path"`
+		Version string  `json:"version,omitempty"`
+		Replace *Module `json:"replace,omitempty"`
+	}
+)
+
+// ParseModuleList parses the output of go list -m all. The main module has no version and is skipped.
+func ParseModuleList(data []byte) []Module {
+	result := []Module{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		original, replacement, replaced := strings.Cut(scanner.Text(), "=>")
+
+		mod := parseModule(original)
+		if mod.Path == "" || (mod.Version == "" && !replaced) {
+			continue
+		}
+
+		if replaced {
+			r := parseModule(replacement)
+			mod.Replace = &r
+		}
+
+		result = append(result, mod)
+	}
+
+	return result
+}
+
+func parseModule(s string) Module {
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 0:
+		return Module{}
+	case 1:
+		return Module{Path: fields[0]}
+	default:
+		return Module{Path: fields[0], Version: fields[1]}
+	}
+}
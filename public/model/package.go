@@ -1,7 +1,45 @@
 package model
 
+import (
+	"fmt"
+	"strings"
+)
+
 type (
+	// Package is a go package included in a build, pinned to Version when it is set.
 	Package struct {
-		Fqn string `json:"fqn"`
+		Url     string `json:"url"`
+		Module  string `json:"module,omitempty"`
+		Version string `json:"version,omitempty"`
+
+		// Library is the catalog entry the package was resolved from; it is not part of the build identity.
+		Library string `json:"library,omitempty" hash:"ignore"`
+	}
+
+	// Requirement is a module pinned to a specific version.
+	Requirement struct {
+		Module  string
+		Version string
 	}
 )
+
+// IsPinned returns true if the module of the package is pinned to a version.
+func (p Package) IsPinned() bool {
+	return p.Version != ""
+}
+
+func (p Package) Validate() error {
+	if p.Url == "" {
+		return fmt.Errorf("package url is required")
+	}
+
+	if p.Version != "" && p.Module == "" {
+		return fmt.Errorf("package %s is pinned to %s but has no module", p.Url, p.Version)
+	}
+
+	if p.Module != "" && p.Url != p.Module && !strings.HasPrefix(p.Url, p.Module+"/") {
+		return fmt.Errorf("package %s is not part of module %s", p.Url, p.Module)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+type (
+	// Phase records the progress of a single step of a build.
+	Phase struct {
+		Name      string       `json:"name"`
+		StartedAt time.Time    `json:"started_at"`
+		EndedAt   *time.Time   `json:"ended_at,omitempty"`
+		Outcome   PhaseOutcome `json:"outcome,omitempty"`
+	}
+
+	PhaseOutcome string
+)
+
+const (
+	PhaseGenerate = "generate"
+	PhaseGet      = "get"
+	PhaseTidy     = "tidy"
+	PhaseBuild    = "build"
+	PhaseUpload   = "upload"
+)
+
+const (
+	PhaseOutcomeSuccess   PhaseOutcome = "success"
+	PhaseOutcomeFailed    PhaseOutcome = "failed"
+	PhaseOutcomeTimeout   PhaseOutcome = "timeout"
+	PhaseOutcomeCancelled PhaseOutcome = "cancelled"
+)
+
+// Duration returns how long the phase took, or has been running so far.
+func (p Phase) Duration(now time.Time) time.Duration {
+	if p.EndedAt != nil {
+		return p.EndedAt.Sub(p.StartedAt)
+	}
+
+	return now.Sub(p.StartedAt)
+}
+
+// StartPhase adds a new running phase to the build.
+func (b *Build) StartPhase(name string, now time.Time) {
+	b.Phases = append(b.Phases, Phase{Name: name, StartedAt: now})
+}
+
+// EndPhase records the outcome of the most recent phase with the given name.
+func (b *Build) EndPhase(name string, now time.Time, outcome PhaseOutcome) {
+	for i := len(b.Phases) - 1; i >= 0; i-- {
+		if b.Phases[i].Name == name && b.Phases[i].EndedAt == nil {
+			b.Phases[i].EndedAt = &now
+			b.Phases[i].Outcome = outcome
+			return
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var nameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_\-]*$`)
+
+// Profile is a version of a distribution profile, a named set of packages teams build their distribution from.
+type Profile struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+	Owner   string `json:"owner"`
+
+	// Packages are the packages of the distribution, with library references already resolved.
+	Packages []Package `json:"packages"`
+
+	// Targets are the platforms the distribution is built for, unless a build asks for others.
+	Targets []Platform `json:"targets,omitempty"`
+
+	// Changes describes what changed compared to the previous version.
+	Changes   string    `json:"changes,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ProfileRef refers to a version of a profile, written as name@version. Version 0 refers to the latest version.
+type ProfileRef struct {
+	Name    string
+	Version int
+}
+
+// ParseProfileRef parses a reference like acme-edge@3. Without a version, the reference is to the latest version.
+func ParseProfileRef(s string) (ProfileRef, error) {
+	name, version, versioned := strings.Cut(s, "@")
+	if err := ValidateProfileName(name); err != nil {
+		return ProfileRef{}, err
+	}
+
+	if !versioned {
+		return ProfileRef{Name: name}, nil
+	}
+
+	v, err := strconv.Atoi(version)
+	if err != nil || v < 1 {
+		return ProfileRef{}, fmt.Errorf("invalid profile version %q, expected a number from 1 onwards", version)
+	}
+
+	return ProfileRef{Name: name, Version: v}, nil
+}
+
+func (r ProfileRef) String() string {
+	if r.Version == 0 {
+		return r.Name
+	}
+
+	return fmt.Sprintf("%s@%d", r.Name, r.Version)
+}
+
+// ValidateProfileName checks the name can be used as a profile name.
+func ValidateProfileName(name string) error {
+	if !nameRegex.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q. must be lowercase and only contain - or _", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// DefaultTagPattern selects the tags tracked by a repository which does not specify any.
+const DefaultTagPattern = "v*"
+
+type (
+	// Repo is a git repository holding benthos components, whose tags matching TagPattern become library versions.
+	Repo struct {
+		Name          string `json:"name"`
+		Module        string `json:"module"`
+		GitUrl        string `json:"git_url"`
+		DefaultBranch string `json:"default_branch,omitempty"`
+
+		// Library is the catalog library the tags are added to. Defaults to the name of the repository.
+		Library string `json:"library,omitempty"`
+
+		// Mirror is the path of the bare mirror relative to the mirror directory of the service, <name>.git by default.
+		Mirror string `json:"mirror,omitempty"`
+
+		// TagPattern is a glob selecting the tracked tags, like v*. Tags holds the ones found by the last sync.
+		TagPattern string   `json:"tag_pattern,omitempty"`
+		Tags       []string `json:"tags,omitempty"`
+
+		LastSync  *RepoSync `json:"last_sync,omitempty"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	// RepoSync describes the outcome of synchronizing a repository with the catalog.
+	RepoSync struct {
+		At time.Time `json:"at"`
+
+		// Added holds the tags which were added to the catalog as a new version.
+		Added []string `json:"added,omitempty"`
+		Error string   `json:"error,omitempty"`
+	}
+)
+
+// LibraryName returns the name of the catalog library the repository is synchronized to.
+func (r *Repo) LibraryName() string {
+	if r.Library == "" {
+		return r.Name
+	}
+
+	return r.Library
+}
+
+// TagGlob returns the pattern selecting the tracked tags.
+func (r *Repo) TagGlob() string {
+	if r.TagPattern == "" {
+		return DefaultTagPattern
+	}
+
+	return r.TagPattern
+}
+
+func (r *Repo) Validate() error {
+	if !nameRegex.MatchString(r.Name) {
+		return fmt.Errorf("invalid repository name %q. must be lowercase and only contain - or _", r.Name)
+	}
+
+	if r.Library != "" && !nameRegex.MatchString(r.Library) {
+		return fmt.Errorf("invalid library name %q. must be lowercase and only contain - or _", r.Library)
+	}
+
+	if r.Module == "" {
+		return fmt.Errorf("module is required")
+	}
+
+	if r.GitUrl == "" {
+		return fmt.Errorf("git url is required")
+	}
+
+	if r.Mirror != "" && !filepath.IsLocal(r.Mirror) {
+		return fmt.Errorf("invalid mirror %q. must be a relative path within the mirror directory", r.Mirror)
+	}
+
+	if _, err := path.Match(r.TagGlob(), ""); err != nil {
+		return fmt.Errorf("invalid tag pattern %q: %w", r.TagPattern, err)
+	}
+
+	return nil
+}
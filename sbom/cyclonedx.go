@@ -0,0 +1,118 @@
+package sbom
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+type (
+	cdxDocument struct {
+		BomFormat    string          `json:"bomFormat"`
+		SpecVersion  string          `json:"specVersion"`
+		SerialNumber string          `json:"serialNumber"`
+		Version      int             `json:"version"`
+		Metadata     cdxMetadata     `json:"metadata"`
+		Components   []cdxComponent  `json:"components"`
+		Dependencies []cdxDependency `json:"dependencies"`
+	}
+
+	cdxMetadata struct {
+		Timestamp  string        `json:"timestamp"`
+		Tools      cdxTools      `json:"tools"`
+		Component  cdxComponent  `json:"component"`
+		Properties []cdxProperty `json:"properties,omitempty"`
+	}
+
+	cdxTools struct {
+		Components []cdxComponent `json:"components"`
+	}
+
+	cdxComponent struct {
+		Type       string        `json:"type"`
+		BomRef     string        `json:"bom-ref,omitempty"`
+		Name       string        `json:"name"`
+		Version    string        `json:"version,omitempty"`
+		Scope      string        `json:"scope,omitempty"`
+		Purl       string        `json:"purl,omitempty"`
+		Properties []cdxProperty `json:"properties,omitempty"`
+	}
+
+	cdxProperty struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+
+	cdxDependency struct {
+		Ref       string   `json:"ref"`
+		DependsOn []string `json:"dependsOn,omitempty"`
+	}
+)
+
+// writeCycloneDX writes a CycloneDX 1.5 document, marking modules not compiled into the executable as excluded.
+func writeCycloneDX(w io.Writer, in *Input) error {
+	main := cdxComponent{
+		Type:    "application",
+		BomRef:  purl(in.Name, in.Version),
+		Name:    in.Name,
+		Version: in.Version,
+		Purl:    purl(in.Name, in.Version),
+	}
+
+	doc := cdxDocument{
+		BomFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + newUUID(),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: timestamp(),
+			Tools:     cdxTools{Components: []cdxComponent{{Type: "application", Name: toolName}}},
+			Component: main,
+		},
+		Components: []cdxComponent{},
+	}
+
+	settings := in.settings()
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		doc.Metadata.Properties = append(doc.Metadata.Properties, cdxProperty{Name: "go:build:" + k, Value: settings[k]})
+	}
+
+	linked := []string{}
+	for _, c := range in.components() {
+		mod := c.effective()
+		comp := cdxComponent{
+			Type:    "library",
+			BomRef:  purl(c.Path, c.Version),
+			Name:    mod.Path,
+			Version: mod.Version,
+			Scope:   "excluded",
+			Purl:    purl(mod.Path, mod.Version),
+		}
+
+		if c.Linked {
+			comp.Scope = "required"
+			linked = append(linked, comp.BomRef)
+		}
+
+		if c.Sum != "" {
+			comp.Properties = append(comp.Properties, cdxProperty{Name: "go:sum", Value: c.Sum})
+		}
+
+		if c.Replace != nil {
+			comp.Properties = append(comp.Properties, cdxProperty{Name: "go:replaces", Value: purl(c.Path, c.Version)})
+		}
+
+		doc.Components = append(doc.Components, comp)
+	}
+
+	doc.Dependencies = []cdxDependency{{Ref: main.BomRef, DependsOn: linked}}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,162 @@
+package sbom
+
+import (
+	"crypto/rand"
+	"debug/buildinfo"
+	"fmt"
+	"github.com/wombatwisdom/wombat-builder/public/model"
+	"io"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Format is the format of a software bill of materials.
+type Format string
+
+const (
+	FormatCycloneDX Format = "cyclonedx"
+	FormatSPDX      Format = "spdx"
+)
+
+// Valid returns true if the format is supported.
+func (f Format) Valid() bool {
+	return f == FormatCycloneDX || f == FormatSPDX
+}
+
+// Extension returns the file extension of documents in the format.
+func (f Format) Extension() string {
+	if f == FormatSPDX {
+		return "spdx.json"
+	}
+
+	return "cdx.json"
+}
+
+// toolName identifies the builder as the author of the generated documents.
+const toolName = "wombat-builder"
+
+// Input holds everything known about a built executable.
+type Input struct {
+	// Name and Version identify the executable itself.
+	Name    string
+	Version string
+
+	// BuildInfo is the build information embedded into the executable by the go toolchain.
+	BuildInfo *debug.BuildInfo
+
+	// Modules is the module graph of the build, as reported by go list -m all. Optional.
+	Modules []model.Module
+}
+
+// ReadInput reads the embedded build information from the executable at the given path.
+func ReadInput(path string, name string, version string) (*Input, error) {
+	bi, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build info: %w", err)
+	}
+
+	return &Input{Name: name, Version: version, BuildInfo: bi}, nil
+}
+
+// Write writes the bill of materials for the input in the given format.
+func Write(w io.Writer, format Format, in *Input) error {
+	switch format {
+	case FormatCycloneDX:
+		return writeCycloneDX(w, in)
+	case FormatSPDX:
+		return writeSPDX(w, in)
+	default:
+		return fmt.Errorf("unsupported sbom format %q", format)
+	}
+}
+
+// component is a module which is part of the bill of materials.
+type component struct {
+	model.Module
+
+	// Sum is the go.sum hash of the module, if it is known.
+	Sum string
+
+	// Linked is true if the module was compiled into the executable.
+	Linked bool
+}
+
+// components merges the modules from the build info with the ones from the module graph, sorted by path.
+func (in *Input) components() []component {
+	byPath := map[string]*component{}
+
+	if in.BuildInfo != nil {
+		for _, dep := range in.BuildInfo.Deps {
+			c := &component{Module: model.Module{Path: dep.Path, Version: dep.Version}, Sum: dep.Sum, Linked: true}
+			if dep.Replace != nil {
+				c.Replace = &model.Module{Path: dep.Replace.Path, Version: dep.Replace.Version}
+				c.Sum = dep.Replace.Sum
+			}
+			byPath[dep.Path] = c
+		}
+	}
+
+	for _, mod := range in.Modules {
+		if _, fnd := byPath[mod.Path]; !fnd {
+			byPath[mod.Path] = &component{Module: mod}
+		}
+	}
+
+	result := make([]component, 0, len(byPath))
+	for _, c := range byPath {
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+
+	return result
+}
+
+// settings returns the build settings embedded in the executable, like GOOS and GOARCH.
+func (in *Input) settings() map[string]string {
+	result := map[string]string{}
+	if in.BuildInfo == nil {
+		return result
+	}
+
+	result["go"] = in.BuildInfo.GoVersion
+	for _, s := range in.BuildInfo.Settings {
+		result[s.Key] = s.Value
+	}
+
+	return result
+}
+
+// purl returns the package url of a go module.
+func purl(path string, version string) string {
+	if version == "" {
+		return fmt.Sprintf("pkg:golang/%s", path)
+	}
+
+	return fmt.Sprintf("pkg:golang/%s@%s", path, strings.ReplaceAll(version, "+", "%2B"))
+}
+
+// effective returns the module which was actually used, taking replacements into account.
+func (c component) effective() model.Module {
+	if c.Replace != nil && c.Replace.Version != "" {
+		return *c.Replace
+	}
+
+	return c.Module
+}
+
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func timestamp() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
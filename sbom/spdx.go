@@ -0,0 +1,109 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+type (
+	spdxDocument struct {
+		SpdxVersion       string             `json:"spdxVersion"`
+		DataLicense       string             `json:"dataLicense"`
+		SPDXID            string             `json:"SPDXID"`
+		Name              string             `json:"name"`
+		DocumentNamespace string             `json:"documentNamespace"`
+		CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+		Packages          []spdxPackage      `json:"packages"`
+		Relationships     []spdxRelationship `json:"relationships"`
+	}
+
+	spdxCreationInfo struct {
+		Created  string   `json:"created"`
+		Creators []string `json:"creators"`
+	}
+
+	spdxPackage struct {
+		Name             string            `json:"name"`
+		SPDXID           string            `json:"SPDXID"`
+		VersionInfo      string            `json:"versionInfo,omitempty"`
+		DownloadLocation string            `json:"downloadLocation"`
+		FilesAnalyzed    bool              `json:"filesAnalyzed"`
+		LicenseConcluded string            `json:"licenseConcluded"`
+		LicenseDeclared  string            `json:"licenseDeclared"`
+		CopyrightText    string            `json:"copyrightText"`
+		ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+	}
+
+	spdxExternalRef struct {
+		ReferenceCategory string `json:"referenceCategory"`
+		ReferenceType     string `json:"referenceType"`
+		ReferenceLocator  string `json:"referenceLocator"`
+	}
+
+	spdxRelationship struct {
+		SpdxElementId      string `json:"spdxElementId"`
+		RelationshipType   string `json:"relationshipType"`
+		RelatedSpdxElement string `json:"relatedSpdxElement"`
+	}
+)
+
+// spdxIdRegex matches the characters which are not allowed in SPDX identifiers.
+var spdxIdRegex = regexp.MustCompile(`[^a-zA-Z0-9.\-]+`)
+
+const spdxNoAssertion = "NOASSERTION"
+
+// writeSPDX writes an SPDX 2.3 document holding only the modules compiled into the executable.
+func writeSPDX(w io.Writer, in *Input) error {
+	mainId := "SPDXRef-Package-" + spdxIdRegex.ReplaceAllString(in.Name, "-")
+	doc := spdxDocument{
+		SpdxVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              fmt.Sprintf("%s-%s", in.Name, in.Version),
+		DocumentNamespace: fmt.Sprintf("https://wombatwisdom.github.io/spdx/%s-%s", spdxIdRegex.ReplaceAllString(in.Version, "-"), newUUID()),
+		CreationInfo: spdxCreationInfo{
+			Created:  timestamp(),
+			Creators: []string{"Tool: " + toolName},
+		},
+		Packages: []spdxPackage{spdxPackageFor(mainId, in.Name, in.Version)},
+		Relationships: []spdxRelationship{
+			{SpdxElementId: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSpdxElement: mainId},
+		},
+	}
+
+	for i, c := range in.components() {
+		if !c.Linked {
+			continue
+		}
+
+		mod := c.effective()
+		id := fmt.Sprintf("SPDXRef-Package-%d-%s", i, spdxIdRegex.ReplaceAllString(mod.Path, "-"))
+		doc.Packages = append(doc.Packages, spdxPackageFor(id, mod.Path, mod.Version))
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SpdxElementId:      mainId,
+			RelationshipType:   "DEPENDS_ON",
+			RelatedSpdxElement: id,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func spdxPackageFor(id string, name string, version string) spdxPackage {
+	return spdxPackage{
+		Name:             name,
+		SPDXID:           id,
+		VersionInfo:      version,
+		DownloadLocation: spdxNoAssertion,
+		LicenseConcluded: spdxNoAssertion,
+		LicenseDeclared:  spdxNoAssertion,
+		CopyrightText:    spdxNoAssertion,
+		ExternalRefs: []spdxExternalRef{
+			{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: purl(name, version)},
+		},
+	}
+}
@@ -0,0 +1,235 @@
+package signing
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/blake2b"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Signatures are minisign compatible. The content is prehashed using blake2b-512 before it is signed, which is what
+// minisign does by default. Keys are plain ed25519 keys in PEM format, like the ones generated by
+// openssl genpkey -algorithm ed25519.
+
+var (
+	algPrehashed = [2]byte{'E', 'D'}
+	algLegacy    = [2]byte{'E', 'd'}
+
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+const (
+	untrustedPrefix = "untrusted comment: "
+	trustedPrefix   = "trusted comment: "
+)
+
+// Signer signs artifacts with an ed25519 key.
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyId [8]byte
+}
+
+// LoadSigner reads a PEM encoded PKCS#8 ed25519 private key from the given file.
+func LoadSigner(path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s is not PEM encoded", path)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not an ed25519 key", path)
+	}
+
+	return NewSigner(edKey), nil
+}
+
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{key: key, keyId: keyIdOf(key.Public().(ed25519.PublicKey))}
+}
+
+// PublicKey returns the public key able to verify the signatures of the signer.
+func (s *Signer) PublicKey() *PublicKey {
+	return &PublicKey{key: s.key.Public().(ed25519.PublicKey), keyId: s.keyId}
+}
+
+// Sign returns the signature of the content read from r. The name ends up in the trusted comment of the signature.
+func (s *Signer) Sign(r io.Reader, name string) ([]byte, error) {
+	digest, err := prehash(r)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, 0, 74)
+	raw = append(raw, algPrehashed[:]...)
+	raw = append(raw, s.keyId[:]...)
+	raw = append(raw, ed25519.Sign(s.key, digest)...)
+
+	trusted := fmt.Sprintf("timestamp:%d\tfile:%s\thashed", time.Now().Unix(), name)
+	global := ed25519.Sign(s.key, append(bytes.Clone(raw[10:]), trusted...))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%ssignature from wombat-builder secret key\n", untrustedPrefix)
+	fmt.Fprintf(&buf, "%s\n", base64.StdEncoding.EncodeToString(raw))
+	fmt.Fprintf(&buf, "%s%s\n", trustedPrefix, trusted)
+	fmt.Fprintf(&buf, "%s\n", base64.StdEncoding.EncodeToString(global))
+	return buf.Bytes(), nil
+}
+
+// PublicKey verifies signatures created by a Signer.
+type PublicKey struct {
+	key   ed25519.PublicKey
+	keyId [8]byte
+}
+
+// ParsePublicKey parses either a minisign public key or a PEM encoded PKIX ed25519 public key.
+func ParsePublicKey(data []byte) (*PublicKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+
+		edKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("public key is not an ed25519 key")
+		}
+
+		return &PublicKey{key: edKey, keyId: keyIdOf(edKey)}, nil
+	}
+
+	lines := contentLines(data)
+	if len(lines) == 0 {
+		return nil, errors.New("public key is empty")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(lines[len(lines)-1])
+	if err != nil || len(raw) != 42 || !bytes.Equal(raw[:2], algLegacy[:]) {
+		return nil, errors.New("public key is not a minisign public key")
+	}
+
+	pk := &PublicKey{key: ed25519.PublicKey(raw[10:])}
+	copy(pk.keyId[:], raw[2:10])
+	return pk, nil
+}
+
+// String returns the public key in the minisign format.
+func (p *PublicKey) String() string {
+	raw := make([]byte, 0, 42)
+	raw = append(raw, algLegacy[:]...)
+	raw = append(raw, p.keyId[:]...)
+	raw = append(raw, p.key...)
+
+	return fmt.Sprintf("%sminisign public key %X\n%s\n", untrustedPrefix, formatKeyId(p.keyId), base64.StdEncoding.EncodeToString(raw))
+}
+
+// Verify checks the signature of the content read from r.
+func (p *PublicKey) Verify(r io.Reader, signature []byte) error {
+	lines := contentLines(signature)
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], untrustedPrefix) || !strings.HasPrefix(lines[2], trustedPrefix) {
+		return fmt.Errorf("%w: malformed signature file", ErrInvalidSignature)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(raw) != 74 {
+		return fmt.Errorf("%w: malformed signature", ErrInvalidSignature)
+	}
+
+	if !bytes.Equal(raw[2:10], p.keyId[:]) {
+		return fmt.Errorf("%w: signed by a different key", ErrInvalidSignature)
+	}
+
+	var message []byte
+	switch {
+	case bytes.Equal(raw[:2], algPrehashed[:]):
+		message, err = prehash(r)
+	case bytes.Equal(raw[:2], algLegacy[:]):
+		message, err = io.ReadAll(r)
+	default:
+		return fmt.Errorf("%w: unsupported signature algorithm", ErrInvalidSignature)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(p.key, message, raw[10:]) {
+		return ErrInvalidSignature
+	}
+
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil {
+		return fmt.Errorf("%w: malformed trusted comment signature", ErrInvalidSignature)
+	}
+
+	trusted := strings.TrimPrefix(lines[2], trustedPrefix)
+	if !ed25519.Verify(p.key, append(bytes.Clone(raw[10:]), trusted...), global) {
+		return fmt.Errorf("%w: trusted comment was tampered with", ErrInvalidSignature)
+	}
+
+	return nil
+}
+
+// Sha256 returns the hex encoded SHA-256 digest of the content read from r.
+func Sha256(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func prehash(r io.Reader) ([]byte, error) {
+	h, _ := blake2b.New512(nil)
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+func keyIdOf(key ed25519.PublicKey) [8]byte {
+	var id [8]byte
+	sum := sha256.Sum256(key)
+	copy(id[:], sum[:8])
+	return id
+}
+
+// formatKeyId renders the key id the way minisign does; as the little-endian number the raw bytes represent.
+func formatKeyId(id [8]byte) string {
+	return fmt.Sprintf("%016X", binary.LittleEndian.Uint64(id[:]))
+}
+
+func contentLines(data []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}